@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/titoffon/merch-store/internal/config"
+	"github.com/titoffon/merch-store/internal/db"
+	"github.com/titoffon/merch-store/internal/migrate"
+	"github.com/titoffon/merch-store/internal/rbac"
+	"github.com/titoffon/merch-store/internal/service"
+	"github.com/titoffon/merch-store/migrations"
+)
+
+const usage = `usage:
+  app                          start the HTTP server
+  app migrate up|down|status   manage the database schema
+  app unlock <username>        lift a login lockout
+  app create-admin <username>  grant the admin role, creating the user with
+                               a password read from stdin if needed
+  app reconcile [-freeze]      check every balance against the ledger and
+                               history, print a JSON report and optionally
+                               freeze mismatched accounts
+  app unfreeze <username>      unfreeze an account after a manual check`
+
+var errUsage = errors.New(usage)
+
+func runCommand(ctx context.Context, cfg *config.Config, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(ctx, cfg, args[1:])
+	case "unlock":
+		return runUnlock(ctx, cfg, args[1:])
+	case "create-admin":
+		return runCreateAdmin(ctx, cfg, args[1:])
+	case "reconcile":
+		return runReconcile(ctx, cfg, args[1:])
+	case "unfreeze":
+		return runUnfreeze(ctx, cfg, args[1:])
+	default:
+		return errUsage
+	}
+}
+
+func runMigrate(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	dal, err := db.New(ctx, cfg.DSN())
+	if err != nil {
+		return err
+	}
+	defer dal.Close()
+
+	m, err := migrate.New(dal.DBPool, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		for _, mig := range applied {
+			fmt.Printf("applied %04d_%s\n", mig.Version, mig.Name)
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		reverted, err := m.Down(ctx)
+		if err != nil {
+			return err
+		}
+		if reverted == nil {
+			fmt.Println("no applied migrations")
+			return nil
+		}
+		fmt.Printf("reverted %04d_%s\n", reverted.Version, reverted.Name)
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range statuses {
+			status, appliedAt := "pending", "-"
+			if s.Applied {
+				status, appliedAt = "applied", s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, status, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return errUsage
+	}
+	return nil
+}
+
+func runUnlock(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	dal, err := db.New(ctx, cfg.DSN())
+	if err != nil {
+		return err
+	}
+	defer dal.Close()
+
+	if err := service.NewAuth(dal, service.AuthConfig{}).Unlock(ctx, args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("unlocked %s\n", args[0])
+	return nil
+}
+
+// runCreateAdmin выдаёт роль admin существующему пользователю или заводит
+// нового. Пароль читается из первой строки stdin, чтобы не светить его в
+// истории команд и списке процессов.
+func runCreateAdmin(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	username := args[0]
+
+	dal, err := db.New(ctx, cfg.DSN())
+	if err != nil {
+		return err
+	}
+	defer dal.Close()
+
+	auth := service.NewAuth(dal, service.AuthConfig{PasswordMinLength: cfg.AuthPasswordMinLength})
+	err = auth.GrantRole(ctx, username, rbac.RoleAdmin)
+	if err == nil {
+		fmt.Printf("granted %s to %s\n", rbac.RoleAdmin, username)
+		return nil
+	}
+	if !errors.Is(err, service.ErrUserNotFound) {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "password for new user %s: ", username)
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read password: %w", err)
+	}
+	fmt.Fprintln(os.Stderr)
+
+	if _, err := auth.Register(ctx, username, strings.TrimRight(password, "\r\n")); err != nil {
+		return err
+	}
+	if err := auth.GrantRole(ctx, username, rbac.RoleAdmin); err != nil {
+		return err
+	}
+	fmt.Printf("created %s with role %s\n", username, rbac.RoleAdmin)
+	return nil
+}
+
+// runReconcile печатает отчёт сверки балансов в stdout. При расхождениях
+// команда завершается с ошибкой, чтобы её можно было запускать из cron.
+func runReconcile(ctx context.Context, cfg *config.Config, args []string) error {
+	freeze := false
+	switch {
+	case len(args) == 1 && args[0] == "-freeze":
+		freeze = true
+	case len(args) != 0:
+		return errUsage
+	}
+	dal, err := db.New(ctx, cfg.DSN())
+	if err != nil {
+		return err
+	}
+	defer dal.Close()
+
+	report, err := service.NewLedger(dal).Reconcile(ctx, freeze)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	if len(report.Mismatches) > 0 {
+		return fmt.Errorf("found %d balance mismatches", len(report.Mismatches))
+	}
+	return nil
+}
+
+func runUnfreeze(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	dal, err := db.New(ctx, cfg.DSN())
+	if err != nil {
+		return err
+	}
+	defer dal.Close()
+
+	if err := service.NewLedger(dal).Unfreeze(ctx, "cli", args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("unfrozen %s\n", args[0])
+	return nil
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/titoffon/merch-store/internal/config"
 	"github.com/titoffon/merch-store/internal/server"
@@ -10,10 +14,19 @@ import (
 func main(){
 
 	cfg := config.LoadConfig()
-	
-	err := server.Run(cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	if len(os.Args) > 1 {
+		err = runCommand(ctx, cfg, os.Args[1:])
+	} else {
+		err = server.Run(ctx, cfg)
+	}
 	if err != nil {
-		fmt.Println()
-		return
+		fmt.Fprintln(os.Stderr, err)
+		stop()
+		os.Exit(1)
 	}
-}
\ No newline at end of file
+}
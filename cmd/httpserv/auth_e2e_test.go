@@ -2,8 +2,11 @@ package httpserv
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"net"
 	"net/http"
+	"os"
 	"testing"
 	"time"
 
@@ -16,25 +19,62 @@ type TestClient struct{
 	baseURL string
 }
 
-func TestE2EAuth(t *testing.T) {
+// loadTestConfig загружает конфиг для e2e-тестов. Если хранилище не задано
+// явно через STORAGE, сценарии гоняются в памяти и Postgres не нужен.
+func loadTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	if _, ok := os.LookupEnv("STORAGE"); !ok {
+		t.Setenv("STORAGE", config.StorageMemory)
+	}
+	return config.LoadConfig()
+}
 
-	cfg := config.LoadConfig()
-	
-	go func(){
-		err := server.Run(cfg)
-		if err != nil {
-			t.Fatal(err)
-		}
+// startServer запускает сервер на время теста и останавливает его в t.Cleanup,
+// дожидаясь освобождения порта, чтобы следующий тест мог занять его снова.
+func startServer(t *testing.T) TestClient {
+	t.Helper()
+	cfg := loadTestConfig(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.Run(ctx, cfg)
 	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-stopped; err != nil {
+			t.Errorf("server stopped with error: %v", err)
+		}
+	})
 
-	time.Sleep(1 * time.Second)
-	if t.Failed(){
-		t.Fatal("fail to start")
+	addr := net.JoinHostPort("localhost", cfg.Port)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		select {
+		case err := <-stopped:
+			t.Fatalf("server failed to start: %v", err)
+		default:
+		}
+
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not start listening on %s: %v", addr, err)
+		}
+		time.Sleep(50 * time.Millisecond)
 	}
 
-	tClient := TestClient{
-		baseURL: "http://localhost:8080/api",
+	return TestClient{
+		baseURL: "http://" + addr + "/api",
 	}
+}
+
+func TestE2EAuth(t *testing.T) {
+
+	tClient := startServer(t)
 
 	t.Run("Auth", func(t *testing.T){
 		t.Run("Green", func(t *testing.T){
@@ -5,11 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
-	"time"
 
-	"github.com/titoffon/merch-store/internal/config"
 	"github.com/titoffon/merch-store/internal/delivery/handlers"
-	"github.com/titoffon/merch-store/internal/server"
 )
 
 type FTUserInfoResponse struct {
@@ -19,23 +16,7 @@ type FTUserInfoResponse struct {
 }
 
 func TestE2EUserInfo(t *testing.T) {
-    cfg := config.LoadConfig()
-    
-    go func() {
-        if err := server.Run(cfg); err != nil {
-            t.Fatal(err)
-        }
-    }()
-
-    time.Sleep(2 * time.Second)
-
-    if t.Failed() {
-        t.Fatal("Server failed to start")
-    }
-
-    tClient := TestClient{
-        baseURL: "http://localhost:8080/api",
-    }
+    tClient := startServer(t)
 
     t.Run("UserInfo", func(t *testing.T) {
 
@@ -5,31 +5,12 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
-	"time"
 
-	"github.com/titoffon/merch-store/internal/config"
 	"github.com/titoffon/merch-store/internal/delivery/handlers"
-	"github.com/titoffon/merch-store/internal/server"
 )
 
 func TestE2EPurchaseMerch(t *testing.T) {
-    cfg := config.LoadConfig()
-
-    go func() {
-        err := server.Run(cfg)
-        if err != nil {
-            t.Fatal(err)
-        }
-    }()
-    time.Sleep(1 * time.Second)
-
-    if t.Failed() {
-        t.Fatal("fail to start")
-    }
-
-    tClient := TestClient{
-        baseURL: "http://localhost:8080/api",
-    }
+    tClient := startServer(t)
 
     resp := tClient.Auth(t, handlers.AuthRequest{
         Username: "merchBuyer2",
@@ -108,16 +89,86 @@ func TestE2EPurchaseMerch(t *testing.T) {
     })
 }
 
+func TestE2EPurchaseMerchLegacyGET(t *testing.T) {
+
+    t.Run("Enabled by default with Deprecation header", func(t *testing.T) {
+        tClient := startServer(t)
+        resp := tClient.Auth(t, handlers.AuthRequest{Username: "legacyBuyer", Password: "legacyPass1"})
+        if resp == nil {
+            t.Fatal("failed to create user: no response")
+        }
+        if resp.Token == nil || resp.code != 200 {
+            t.Fatalf("failed to create user: code=%d, err=%v", resp.code, resp.Error)
+        }
+        userToken := resp.Token.Token
+
+        buyResp := tClient.PurchaseMerchGET(t, "cup", userToken)
+        if buyResp.code != http.StatusOK {
+            t.Fatalf("expected 200, got %d (err=%v)", buyResp.code, buyResp.Error)
+        }
+        if buyResp.deprecation != "true" {
+            t.Errorf("expected Deprecation: true, got %q", buyResp.deprecation)
+        }
+
+        buyResp = tClient.PurchaseMerch(t, "cup", userToken)
+        if buyResp.code != http.StatusOK {
+            t.Fatalf("expected 200, got %d (err=%v)", buyResp.code, buyResp.Error)
+        }
+        if buyResp.deprecation != "" {
+            t.Errorf("expected no Deprecation header on POST, got %q", buyResp.deprecation)
+        }
+
+        info := tClient.GetUserInfo(t, userToken)
+        if info.code != http.StatusOK || info.Info.Coins != 960 {
+            t.Errorf("expected both purchases to be charged, got %+v", info)
+        }
+    })
+
+    t.Run("Disabled => 405", func(t *testing.T) {
+        t.Setenv("API_LEGACY_GET_BUY", "false")
+        tClient := startServer(t)
+        resp := tClient.Auth(t, handlers.AuthRequest{Username: "legacyBuyer", Password: "legacyPass1"})
+        if resp == nil {
+            t.Fatal("failed to create user: no response")
+        }
+        if resp.Token == nil || resp.code != 200 {
+            t.Fatalf("failed to create user: code=%d, err=%v", resp.code, resp.Error)
+        }
+        userToken := resp.Token.Token
+
+        buyResp := tClient.PurchaseMerchGET(t, "cup", userToken)
+        if buyResp.code != http.StatusMethodNotAllowed {
+            t.Fatalf("expected 405, got %d", buyResp.code)
+        }
+        buyResp = tClient.PurchaseMerch(t, "cup", userToken)
+        if buyResp.code != http.StatusOK {
+            t.Fatalf("expected 200, got %d (err=%v)", buyResp.code, buyResp.Error)
+        }
+    })
+}
+
 type FTPurchaseMerchResp struct {
     code  int64
     Error *handlers.ErrorResponse
+    // deprecation - заголовок Deprecation ответа.
+    deprecation string
 }
 
+// PurchaseMerch покупает товар через POST /api/buy/{item}.
 func (tc *TestClient) PurchaseMerch(t *testing.T, item, token string) *FTPurchaseMerchResp {
+    return tc.purchaseMerch(t, http.MethodPost, item, token)
+}
+
+// PurchaseMerchGET покупает товар через устаревший GET /api/buy/{item}.
+func (tc *TestClient) PurchaseMerchGET(t *testing.T, item, token string) *FTPurchaseMerchResp {
+    return tc.purchaseMerch(t, http.MethodGet, item, token)
+}
+
+func (tc *TestClient) purchaseMerch(t *testing.T, method, item, token string) *FTPurchaseMerchResp {
     url := fmt.Sprintf("%s/buy/%s", tc.baseURL, item)
-    req, err := http.NewRequest("GET", url, nil)
+    req, err := http.NewRequest(method, url, nil)
     if err != nil {
-        t.Fatal("failed to create GET request:", err)
+        t.Fatalf("failed to create %s request: %v", method, err)
     }
 
     if token != "" {
@@ -126,18 +177,20 @@ func (tc *TestClient) PurchaseMerch(t *testing.T, item, token string) *FTPurchas
 
     resp, err := http.DefaultClient.Do(req)
     if err != nil {
-        t.Fatal("failed to do GET request:", err)
+        t.Fatalf("failed to do %s request: %v", method, err)
     }
     t.Cleanup(func() {
         resp.Body.Close()
     })
+    deprecation := resp.Header.Get("Deprecation")
 
     switch resp.StatusCode {
     case http.StatusOK:
 
         return &FTPurchaseMerchResp{
-            code:  200,
-            Error: nil,
+            code:        200,
+            Error:       nil,
+            deprecation: deprecation,
         }
     case 400, 401, 500:
         var e handlers.ErrorResponse
@@ -145,11 +198,12 @@ func (tc *TestClient) PurchaseMerch(t *testing.T, item, token string) *FTPurchas
             t.Fatal("failed to decode error response:", err)
         }
         return &FTPurchaseMerchResp{
-            code:  int64(resp.StatusCode),
-            Error: &e,
+            code:        int64(resp.StatusCode),
+            Error:       &e,
+            deprecation: deprecation,
         }
     default:
         t.Logf("Unhandled status: %d", resp.StatusCode)
-        return &FTPurchaseMerchResp{code: int64(resp.StatusCode)}
+        return &FTPurchaseMerchResp{code: int64(resp.StatusCode), deprecation: deprecation}
     }
-}
\ No newline at end of file
+}
@@ -5,11 +5,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"testing"
-	"time"
 
-	"github.com/titoffon/merch-store/internal/config"
 	"github.com/titoffon/merch-store/internal/delivery/handlers"
-	"github.com/titoffon/merch-store/internal/server"
 )
 
 type FTSendCoinResponse struct {
@@ -19,24 +16,7 @@ type FTSendCoinResponse struct {
 
 
 func TestE2ESendCoins(t *testing.T) {
-    cfg := config.LoadConfig()
-
-    go func() {
-        err := server.Run(cfg)
-        if err != nil {
-            t.Fatal(err)
-        }
-    }()
-
-    time.Sleep(1 * time.Second)
-
-    if t.Failed() {
-        t.Fatal("Server failed to start")
-    }
-
-    tClient := TestClient{
-        baseURL: "http://localhost:8080/api",
-    }
+    tClient := startServer(t)
 
     t.Run("SendCoins", func(t *testing.T) {
 
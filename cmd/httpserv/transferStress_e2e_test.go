@@ -0,0 +1,106 @@
+package httpserv
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "sync"
+    "testing"
+
+    "github.com/titoffon/merch-store/internal/config"
+    "github.com/titoffon/merch-store/internal/delivery/handlers"
+)
+
+// TestE2ECrossTransfersStress гоняет встречные переводы между двумя
+// пользователями параллельно. Хранилище в памяти выполняет транзакции по
+// очереди, поэтому здесь проверяется только итоговый баланс.
+func TestE2ECrossTransfersStress(t *testing.T) {
+    runCrossTransfers(t, startServer(t), 8, 25)
+}
+
+// TestE2ECrossTransfersStressPostgres - то же против Postgres. Без блокировки
+// счетов в одном порядке и повтора транзакций часть запросов падала бы
+// с deadlock и 500.
+func TestE2ECrossTransfersStressPostgres(t *testing.T) {
+    if os.Getenv("STORAGE") != config.StoragePostgres {
+        t.Skip("set STORAGE=postgres to run against Postgres")
+    }
+    runCrossTransfers(t, startServer(t), 16, 50)
+}
+
+func runCrossTransfers(t *testing.T, tClient TestClient, workers, transfers int) {
+    t.Helper()
+
+    tokens := make(map[string]string)
+    for _, name := range []string{"stressAlice", "stressBob"} {
+        authResp := tClient.Auth(t, handlers.AuthRequest{Username: name, Password: name + "Pass"})
+        if authResp == nil {
+            t.Fatalf("failed to create %s: no response", name)
+        }
+        if authResp.Token == nil || authResp.code != http.StatusOK {
+            t.Fatalf("failed to create %s: code=%d, err=%v", name, authResp.code, authResp.Error)
+        }
+        tokens[name] = authResp.Token.Token
+    }
+
+    before := make(map[string]int64)
+    for name, token := range tokens {
+        before[name] = tClient.GetUserInfo(t, token).Info.Coins
+    }
+
+    var wg sync.WaitGroup
+    errs := make(chan error, 2*workers*transfers)
+    for w := range 2 * workers {
+        from, to := "stressAlice", "stressBob"
+        if w%2 == 1 {
+            from, to = to, from
+        }
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for range transfers {
+                code, err := tClient.sendCoinsStatus(tokens[from], handlers.SendCoinRequest{ToUser: to, Amount: 3})
+                if err == nil && code != http.StatusOK {
+                    err = fmt.Errorf("%s -> %s: expected 200, got %d", from, to, code)
+                }
+                if err != nil {
+                    errs <- err
+                }
+            }
+        }()
+    }
+    wg.Wait()
+    close(errs)
+    for err := range errs {
+        t.Error(err)
+    }
+
+    for name, token := range tokens {
+        if coins := tClient.GetUserInfo(t, token).Info.Coins; coins != before[name] {
+            t.Errorf("expected %s to end with %d coins, got %d", name, before[name], coins)
+        }
+    }
+}
+
+// sendCoinsStatus - SendCoins без t.Fatal, чтобы его можно было звать из горутин.
+func (tc *TestClient) sendCoinsStatus(token string, body handlers.SendCoinRequest) (int, error) {
+    reqBody, err := json.Marshal(body)
+    if err != nil {
+        return 0, err
+    }
+    req, err := http.NewRequest("POST", tc.baseURL+"/sendCoin", bytes.NewReader(reqBody))
+    if err != nil {
+        return 0, err
+    }
+    req.Header.Set("Authorization", "Bearer "+token)
+    req.Header.Set("Content-Type", "application/json")
+
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+    return resp.StatusCode, nil
+}
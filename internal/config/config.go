@@ -1,44 +1,233 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
+)
+
 type Config struct {
-	Port        string
-	DBHost      string
-	DBUser      string
-	DBPassword  string
-	DBName      string
-	DBPort      string
-	JWTSecret   string
-	LogLevel    string
+	Port       string
+	DBHost     string
+	DBUser     string
+	DBPassword string
+	DBName     string
+	DBPort     string
+	JWTSecret  string
+	LogLevel   string
+
+	JWTIssuer   string
+	JWTAudience string
+	// JWTAlgorithm - единственный принимаемый алгоритм подписи: HS256, RS256 или EdDSA.
+	JWTAlgorithm string
+	// JWTKeyID - kid текущего ключа подписи.
+	JWTKeyID string
+	// JWTPreviousSecrets - предыдущие секреты HS256 по kid, принимаются только при проверке.
+	JWTPreviousSecrets map[string]string
+	// JWTPrivateKeyFile - PEM с закрытым ключом для RS256/EdDSA.
+	JWTPrivateKeyFile string
+	// JWTPreviousPublicKeyFiles - PEM-файлы предыдущих открытых ключей по kid.
+	JWTPreviousPublicKeyFiles map[string]string
+	// JWTAccessTTL - время жизни access-токена, JWTRefreshTTL - refresh-токена.
+	JWTAccessTTL  time.Duration
+	JWTRefreshTTL time.Duration
+
+	// AuthAutoRegister разрешает /api/auth создавать пользователя с
+	// неизвестным именем. Выключенный режим требует /api/register.
+	AuthAutoRegister bool
+	// AuthPasswordMinLength - минимальная длина пароля при регистрации.
+	AuthPasswordMinLength int
+	// AuthLockoutThreshold - неудачных входов по имени до блокировки (0 - без
+	// блокировок), AuthLockoutIPThreshold - то же для одного IP-адреса.
+	AuthLockoutThreshold   int
+	AuthLockoutIPThreshold int
+	// Блокировка длится AuthLockoutBaseDelay и удваивается с каждой новой
+	// неудачей до AuthLockoutMaxDelay. Счётчик забывается через AuthLockoutWindow.
+	AuthLockoutBaseDelay time.Duration
+	AuthLockoutMaxDelay  time.Duration
+	AuthLockoutWindow    time.Duration
+
+	// OrderCancelWindow - сколько после оформления пользователь может сам
+	// отменить заказ (0 - только через администратора).
+	OrderCancelWindow time.Duration
+	// LegacyGetBuy оставляет устаревший GET /api/buy/{item} рядом с POST.
+	// Пока идёт срок вывода из употребления, включён по умолчанию; в следующем
+	// релизе умолчание станет false.
+	LegacyGetBuy bool
+	// IdempotencyTTL - сколько хранится ответ на запрос с Idempotency-Key.
+	IdempotencyTTL time.Duration
+	// ReconcileAt - время суток по UTC, когда сервер сверяет балансы
+	// с историей (отрицательное - не сверяет). ReconcileFreeze замораживает
+	// счета с расхождением.
+	ReconcileAt     time.Duration
+	ReconcileFreeze bool
+
+	// Storage выбирает хранилище: "postgres" или "memory".
+	Storage string
+	// AutoMigrate накатывает миграции схемы при старте сервера.
+	AutoMigrate bool
+
+	HTTPReadTimeout       time.Duration
+	HTTPReadHeaderTimeout time.Duration
+	HTTPWriteTimeout      time.Duration
+	HTTPIdleTimeout       time.Duration
+	// ShutdownTimeout - сколько ждать завершения активных запросов при остановке.
+	ShutdownTimeout time.Duration
 }
 
 func LoadConfig() *Config {
 	err := godotenv.Load("../../.env")
 	if err != nil {
-		log.Fatal("Error loading .env file: ", err)
+		log.Println("Failed to load .env file, using environment and defaults: ", err)
 	}
 
 	return &Config{
-		Port:        getEnv("PORT", "8080"),
-		DBHost:      getEnv("DB_HOST", "localhost"),
-		DBUser:      getEnv("DB_USER", "coins_user"),
-		DBPassword:  getEnv("DB_PASSWORD", "coins_pass"),
-		DBName:      getEnv("DB_NAME", "coins_db"),
-		DBPort:      getEnv("DB_PORT", "5432"),
-		JWTSecret:   getEnv("JWT_SECRET", "mysecretkey"),
-		LogLevel: 	 getEnv("LOG_lEVEL", "WARN"),
+		Port:       getEnv("PORT", "8080"),
+		DBHost:     getEnv("DB_HOST", "localhost"),
+		DBUser:     getEnv("DB_USER", "coins_user"),
+		DBPassword: getEnv("DB_PASSWORD", "coins_pass"),
+		DBName:     getEnv("DB_NAME", "coins_db"),
+		DBPort:     getEnv("DB_PORT", "5432"),
+		JWTSecret:  getEnv("JWT_SECRET", "mysecretkey"),
+		LogLevel:   getEnv("LOG_lEVEL", "WARN"),
+
+		JWTIssuer:    getEnv("JWT_ISSUER", "merch-store"),
+		JWTAudience:  getEnv("JWT_AUDIENCE", "merch-store"),
+		JWTAlgorithm: getEnv("JWT_ALGORITHM", "HS256"),
+		JWTKeyID:     getEnv("JWT_KEY_ID", "default"),
+
+		JWTPreviousSecrets:        getEnvMap("JWT_PREVIOUS_SECRETS"),
+		JWTPrivateKeyFile:         getEnv("JWT_PRIVATE_KEY_FILE", ""),
+		JWTPreviousPublicKeyFiles: getEnvMap("JWT_PREVIOUS_PUBLIC_KEY_FILES"),
+		JWTAccessTTL:              getEnvDuration("JWT_ACCESS_TTL", 15*time.Minute),
+		JWTRefreshTTL:             getEnvDuration("JWT_REFRESH_TTL", 30*24*time.Hour),
+
+		AuthAutoRegister:      getEnvBool("AUTH_AUTO_REGISTER", true),
+		AuthPasswordMinLength: getEnvInt("AUTH_PASSWORD_MIN_LENGTH", 8),
+
+		AuthLockoutThreshold:   getEnvInt("AUTH_LOCKOUT_THRESHOLD", 5),
+		AuthLockoutIPThreshold: getEnvInt("AUTH_LOCKOUT_IP_THRESHOLD", 20),
+		AuthLockoutBaseDelay:   getEnvDuration("AUTH_LOCKOUT_BASE_DELAY", 30*time.Second),
+		AuthLockoutMaxDelay:    getEnvDuration("AUTH_LOCKOUT_MAX_DELAY", time.Hour),
+		AuthLockoutWindow:      getEnvDuration("AUTH_LOCKOUT_WINDOW", time.Hour),
+
+		OrderCancelWindow: getEnvDuration("ORDER_CANCEL_WINDOW", 30*time.Minute),
+		IdempotencyTTL:    getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		LegacyGetBuy:      getEnvBool("API_LEGACY_GET_BUY", true),
+		ReconcileAt:       getEnvTimeOfDay("RECONCILE_AT", 3*time.Hour),
+		ReconcileFreeze:   getEnvBool("RECONCILE_FREEZE", false),
+
+		Storage:     getEnv("STORAGE", StoragePostgres),
+		AutoMigrate: getEnvBool("DB_AUTO_MIGRATE", true),
+
+		HTTPReadTimeout:       getEnvDuration("HTTP_READ_TIMEOUT", 10*time.Second),
+		HTTPReadHeaderTimeout: getEnvDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		HTTPWriteTimeout:      getEnvDuration("HTTP_WRITE_TIMEOUT", 15*time.Second),
+		HTTPIdleTimeout:       getEnvDuration("HTTP_IDLE_TIMEOUT", 60*time.Second),
+		ShutdownTimeout:       getEnvDuration("SHUTDOWN_TIMEOUT", 20*time.Second),
 	}
 }
 
+// DSN собирает строку подключения к Postgres.
+func (c *Config) DSN() string {
+	return fmt.Sprintf("postgresql://%s:%s@%s:%s/%s?sslmode=disable",
+		c.DBUser,
+		c.DBPassword,
+		c.DBHost,
+		c.DBPort,
+		c.DBName,
+	)
+}
+
 func getEnv(key, fallback string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
 	}
 	return fallback
-}
\ No newline at end of file
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid boolean %s=%q, using %t", key, value, fallback)
+		return fallback
+	}
+	return b
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer %s=%q, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration %s=%q, using %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// getEnvTimeOfDay разбирает время суток "15:04" и возвращает его как
+// смещение от полуночи. Пустое значение или "off" - -1.
+func getEnvTimeOfDay(key string, fallback time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	if value == "" || value == "off" {
+		return -1
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		log.Printf("Invalid time of day %s=%q, using %s", key, value, fallback)
+		return fallback
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
+
+// getEnvMap разбирает значение вида "kid1:value1,kid2:value2".
+func getEnvMap(key string) map[string]string {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return nil
+	}
+
+	result := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || k == "" || v == "" {
+			log.Printf("Invalid entry %q in %s, expected key:value", pair, key)
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
@@ -2,6 +2,7 @@ package config_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/titoffon/merch-store/internal/config"
 )
@@ -24,3 +25,89 @@ func TestLoadConfig(t *testing.T) {
         t.Errorf("expected default LOG_LEVEL=WARN, got=%s", cfg.LogLevel)
     }
 }
+
+func TestLoadConfigAutoMigrate(t *testing.T) {
+	cfg := config.LoadConfig()
+	if !cfg.AutoMigrate {
+		t.Error("expected AutoMigrate to be enabled by default")
+	}
+
+	t.Setenv("DB_AUTO_MIGRATE", "false")
+	cfg = config.LoadConfig()
+	if cfg.AutoMigrate {
+		t.Error("expected AutoMigrate=false from DB_AUTO_MIGRATE")
+	}
+}
+
+func TestLoadConfigTimeouts(t *testing.T) {
+	t.Setenv("HTTP_WRITE_TIMEOUT", "3s")
+	t.Setenv("SHUTDOWN_TIMEOUT", "not-a-duration")
+
+	cfg := config.LoadConfig()
+
+	if cfg.HTTPWriteTimeout != 3*time.Second {
+		t.Errorf("expected HTTPWriteTimeout=3s, got=%s", cfg.HTTPWriteTimeout)
+	}
+	if cfg.ShutdownTimeout != 20*time.Second {
+		t.Errorf("expected default ShutdownTimeout=20s for invalid value, got=%s", cfg.ShutdownTimeout)
+	}
+}
+
+func TestLoadConfigKeyMaps(t *testing.T) {
+	t.Setenv("JWT_PREVIOUS_SECRETS", "2024:oldSecret, 2023:olderSecret,broken")
+
+	cfg := config.LoadConfig()
+
+	if len(cfg.JWTPreviousSecrets) != 2 {
+		t.Fatalf("expected 2 previous secrets, got %v", cfg.JWTPreviousSecrets)
+	}
+	if cfg.JWTPreviousSecrets["2024"] != "oldSecret" || cfg.JWTPreviousSecrets["2023"] != "olderSecret" {
+		t.Errorf("unexpected previous secrets: %v", cfg.JWTPreviousSecrets)
+	}
+	if cfg.JWTAlgorithm != "HS256" {
+		t.Errorf("expected default JWTAlgorithm=HS256, got=%s", cfg.JWTAlgorithm)
+	}
+}
+
+func TestLoadConfigAuth(t *testing.T) {
+	cfg := config.LoadConfig()
+	if !cfg.AuthAutoRegister {
+		t.Error("expected AuthAutoRegister to be enabled by default")
+	}
+	if cfg.AuthPasswordMinLength != 8 {
+		t.Errorf("expected default AuthPasswordMinLength=8, got=%d", cfg.AuthPasswordMinLength)
+	}
+	if cfg.AuthLockoutThreshold != 5 || cfg.AuthLockoutBaseDelay != 30*time.Second {
+		t.Errorf("unexpected lockout defaults: threshold=%d base delay=%s", cfg.AuthLockoutThreshold, cfg.AuthLockoutBaseDelay)
+	}
+
+	t.Setenv("AUTH_AUTO_REGISTER", "false")
+	t.Setenv("AUTH_PASSWORD_MIN_LENGTH", "12")
+	cfg = config.LoadConfig()
+	if cfg.AuthAutoRegister {
+		t.Error("expected AuthAutoRegister=false from AUTH_AUTO_REGISTER")
+	}
+	if cfg.AuthPasswordMinLength != 12 {
+		t.Errorf("expected AuthPasswordMinLength=12, got=%d", cfg.AuthPasswordMinLength)
+	}
+}
+
+func TestLoadConfigReconcileAt(t *testing.T) {
+	cfg := config.LoadConfig()
+	if cfg.ReconcileAt != 3*time.Hour {
+		t.Errorf("expected default ReconcileAt=3h, got=%s", cfg.ReconcileAt)
+	}
+
+	t.Setenv("RECONCILE_AT", "23:45")
+	if cfg = config.LoadConfig(); cfg.ReconcileAt != 23*time.Hour+45*time.Minute {
+		t.Errorf("expected ReconcileAt=23h45m from RECONCILE_AT, got=%s", cfg.ReconcileAt)
+	}
+	t.Setenv("RECONCILE_AT", "off")
+	if cfg = config.LoadConfig(); cfg.ReconcileAt >= 0 {
+		t.Errorf("expected RECONCILE_AT=off to disable reconciliation, got=%s", cfg.ReconcileAt)
+	}
+	t.Setenv("RECONCILE_AT", "25:00")
+	if cfg = config.LoadConfig(); cfg.ReconcileAt != 3*time.Hour {
+		t.Errorf("expected an invalid RECONCILE_AT to fall back to 3h, got=%s", cfg.ReconcileAt)
+	}
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AuditEntry - запись журнала действий администраторов. Details - JSON с
+// подробностями, например состоянием объекта до и после изменения.
+type AuditEntry struct {
+	ID        int64
+	Actor     string
+	Action    string
+	Target    string
+	Details   []byte
+	CreatedAt time.Time
+}
+
+func (r *DB) InsertAuditEntry(ctx context.Context, entry AuditEntry, conn Querier) error {
+
+	if entry.Details == nil {
+		entry.Details = []byte("{}")
+	}
+	q := "INSERT INTO audit_log (actor, action, target, details) VALUES ($1, $2, $3, $4)"
+	_, err := conn.Exec(ctx, q, entry.Actor, entry.Action, entry.Target, entry.Details)
+	if err != nil {
+		return fmt.Errorf("failed to INSERT INTO audit_log: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEntries возвращает последние записи журнала по target, новые первыми.
+func (r *DB) ListAuditEntries(ctx context.Context, target string, limit int) ([]AuditEntry, error) {
+
+	q := `
+		SELECT id, actor, action, target, details, created_at
+		FROM audit_log
+		WHERE target = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`
+	rows, err := r.DBPool.Query(ctx, q, target, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit_log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Target, &e.Details, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit_log: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (t *pgTx) InsertAuditEntry(ctx context.Context, entry AuditEntry) error {
+	return t.db.InsertAuditEntry(ctx, entry, t.tx)
+}
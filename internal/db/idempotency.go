@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// IdempotencyRecord - запрос, выполненный с заголовком Idempotency-Key.
+// StatusCode равен нулю, пока запрос выполняется.
+type IdempotencyRecord struct {
+	Username    string
+	Key         string
+	Fingerprint string
+	StatusCode  int
+	ContentType string
+	Response    []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// ReserveIdempotencyKey занимает ключ за запросом rec. Истёкший к моменту now
+// ключ занимается заново. Если ключ занят, возвращает его запись и false.
+func (r *DB) ReserveIdempotencyKey(ctx context.Context, rec IdempotencyRecord, now time.Time) (*IdempotencyRecord, bool, error) {
+
+	insert := `
+		INSERT INTO idempotency_keys (username, key, fingerprint, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (username, key) DO UPDATE SET
+			fingerprint = EXCLUDED.fingerprint,
+			status_code = NULL,
+			content_type = '',
+			response = NULL,
+			created_at = EXCLUDED.created_at,
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= $6
+	`
+	selectQ := `
+		SELECT username, key, fingerprint, COALESCE(status_code, 0), content_type, response, created_at, expires_at
+		FROM idempotency_keys
+		WHERE username = $1 AND key = $2
+	`
+	// Ключ могут освободить между INSERT и SELECT, тогда пробуем ещё раз.
+	for range 3 {
+		tag, err := r.DBPool.Exec(ctx, insert, rec.Username, rec.Key, rec.Fingerprint, rec.CreatedAt, rec.ExpiresAt, now)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+		}
+		if tag.RowsAffected() == 1 {
+			return &rec, true, nil
+		}
+
+		var existing IdempotencyRecord
+		err = r.DBPool.QueryRow(ctx, selectQ, rec.Username, rec.Key).Scan(
+			&existing.Username, &existing.Key, &existing.Fingerprint, &existing.StatusCode,
+			&existing.ContentType, &existing.Response, &existing.CreatedAt, &existing.ExpiresAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to query idempotency key: %w", err)
+		}
+		return &existing, false, nil
+	}
+	return nil, false, fmt.Errorf("failed to reserve idempotency key: key keeps being released")
+}
+
+// CompleteIdempotencyKey сохраняет ответ на запрос.
+func (r *DB) CompleteIdempotencyKey(ctx context.Context, rec IdempotencyRecord) error {
+
+	q := `
+		UPDATE idempotency_keys SET status_code = $3, content_type = $4, response = $5
+		WHERE username = $1 AND key = $2
+	`
+	_, err := r.DBPool.Exec(ctx, q, rec.Username, rec.Key, rec.StatusCode, rec.ContentType, rec.Response)
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey освобождает ключ, чтобы запрос можно было повторить.
+func (r *DB) ReleaseIdempotencyKey(ctx context.Context, username, key string) error {
+
+	q := "DELETE FROM idempotency_keys WHERE username = $1 AND key = $2"
+	if _, err := r.DBPool.Exec(ctx, q, username, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys удаляет ключи, истёкшие к моменту now.
+func (r *DB) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+
+	q := "DELETE FROM idempotency_keys WHERE expires_at <= $1"
+	tag, err := r.DBPool.Exec(ctx, q, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
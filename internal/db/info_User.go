@@ -3,29 +3,51 @@ package db
 import (
 	"context"
 	"fmt"
+	"time"
 )
 
 type PurchaseCount struct {
     MerchItem string
     Quantity  int64
+    // Details - строки покупок товара с ценой в момент оплаты, старые первыми.
+    Details   []PurchaseDetail
+}
+
+// PurchaseDetail - одна строка покупки. OrderID - 0 для покупки без заказа.
+type PurchaseDetail struct {
+    OrderID     int64
+    Quantity    int64
+    Price       int64
+    Currency    string
+    PurchasedAt time.Time
 }
 
 type ReceivedTransaction struct {
+    ID       int64
     FromUser string
     Amount   int64
+    Message  string
+    Category string
+    // Reaction - реакция получателя, пустая, если он не реагировал.
+    Reaction string
 }
 
 type SentTransaction struct {
-    ToUser string
-    Amount int64
+    ID       int64
+    ToUser   string
+    Amount   int64
+    Message  string
+    Category string
+    Reaction string
 }
 
 func (r *DB) GetUserPurchases(ctx context.Context, username string) ([]PurchaseCount, error) {
 	q := `
-			SELECT merch_item, COUNT(*) as quantity
-			FROM purchases
-			WHERE username = $1
-			GROUP BY merch_item
+			SELECT p.merch_item, COALESCE(p.order_id, 0), p.quantity, p.price, p.currency, p.created_at
+			FROM purchases p
+			LEFT JOIN orders o ON o.id = p.order_id
+			WHERE p.username = $1 AND (o.status IS NULL OR o.status <> 'cancelled')
+			ORDER BY p.merch_item, p.created_at
 		`
 	rows, err := r.DBPool.Query(ctx, q, username)
     if err != nil {
@@ -35,11 +57,17 @@ func (r *DB) GetUserPurchases(ctx context.Context, username string) ([]PurchaseC
 
     var results []PurchaseCount
     for rows.Next() {
-        var pc PurchaseCount
-        if err := rows.Scan(&pc.MerchItem, &pc.Quantity); err != nil {
+        var item string
+        var d PurchaseDetail
+        if err := rows.Scan(&item, &d.OrderID, &d.Quantity, &d.Price, &d.Currency, &d.PurchasedAt); err != nil {
             return nil, fmt.Errorf("failed to scan user purchases: %w", err)
         }
-        results = append(results, pc)
+        if n := len(results); n == 0 || results[n-1].MerchItem != item {
+            results = append(results, PurchaseCount{MerchItem: item})
+        }
+        pc := &results[len(results)-1]
+        pc.Quantity += d.Quantity
+        pc.Details = append(pc.Details, d)
     }
     if err := rows.Err(); err != nil {
         return nil, err
@@ -49,10 +77,10 @@ func (r *DB) GetUserPurchases(ctx context.Context, username string) ([]PurchaseC
 
 func (r *DB) GetTransactionsReceived(ctx context.Context, username string) ([]ReceivedTransaction, error) {
     q := `
-        SELECT sender, amount
+        SELECT id, sender, amount, message, category, reaction
         FROM transaction_log
         WHERE recipient = $1
-        ORDER BY created_at DESC
+        ORDER BY created_at DESC, id DESC
     `
     rows, err := r.DBPool.Query(ctx, q, username)
     if err != nil {
@@ -63,7 +91,7 @@ func (r *DB) GetTransactionsReceived(ctx context.Context, username string) ([]Re
     var results []ReceivedTransaction
     for rows.Next() {
         var rt ReceivedTransaction
-        if err := rows.Scan(&rt.FromUser, &rt.Amount); err != nil {
+        if err := rows.Scan(&rt.ID, &rt.FromUser, &rt.Amount, &rt.Message, &rt.Category, &rt.Reaction); err != nil {
             return nil, fmt.Errorf("failed to scan received transaction: %w", err)
         }
         results = append(results, rt)
@@ -76,10 +104,10 @@ func (r *DB) GetTransactionsReceived(ctx context.Context, username string) ([]Re
 
 func (r *DB) GetTransactionsSent(ctx context.Context, username string) ([]SentTransaction, error) {
     q := `
-        SELECT recipient, amount
+        SELECT id, recipient, amount, message, category, reaction
         FROM transaction_log
         WHERE sender = $1
-        ORDER BY created_at DESC
+        ORDER BY created_at DESC, id DESC
     `
     rows, err := r.DBPool.Query(ctx, q, username)
     if err != nil {
@@ -90,7 +118,7 @@ func (r *DB) GetTransactionsSent(ctx context.Context, username string) ([]SentTr
     var results []SentTransaction
     for rows.Next() {
         var st SentTransaction
-        if err := rows.Scan(&st.ToUser, &st.Amount); err != nil {
+        if err := rows.Scan(&st.ID, &st.ToUser, &st.Amount, &st.Message, &st.Category, &st.Reaction); err != nil {
             return nil, fmt.Errorf("failed to scan sent transaction: %w", err)
         }
         results = append(results, st)
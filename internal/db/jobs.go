@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// TryLock берёт сессионную advisory-блокировку name на отдельном соединении.
+// Если блокировку держит другой процесс, возвращает ok == false. unlock
+// снимает блокировку и возвращает соединение в пул.
+func (r *DB) TryLock(ctx context.Context, name string) (unlock func(), ok bool, err error) {
+
+	conn, err := r.DBPool.Acquire(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", name).Scan(&ok); err != nil {
+		conn.Release()
+		return nil, false, fmt.Errorf("failed to take lock %s: %w", name, err)
+	}
+	if !ok {
+		conn.Release()
+		return nil, false, nil
+	}
+
+	return func() {
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", name); err != nil {
+			slog.Error("Failed to release lock", slog.String("lock", name), slog.String("error", err.Error()))
+			// Соединение с неснятой блокировкой нельзя отдавать в пул.
+			_ = conn.Conn().Close(context.Background())
+		}
+		conn.Release()
+	}, true, nil
+}
+
+// ClaimJobRun отмечает запуск задачи job за слот slot. Возвращает false,
+// если этот слот уже занял другой экземпляр сервиса.
+func (r *DB) ClaimJobRun(ctx context.Context, job string, slot time.Time) (bool, error) {
+
+	q := "INSERT INTO job_runs (job, slot) VALUES ($1, $2) ON CONFLICT (job, slot) DO NOTHING"
+	tag, err := r.DBPool.Exec(ctx, q, job, slot)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim job run: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Системные счета главной книги. Их баланс может быть отрицательным.
+const (
+	// AccountIssuance - источник монет, которые выдаются пользователям.
+	AccountIssuance = "system:issuance"
+	// AccountShop - выручка магазина, из неё же делаются возвраты.
+	AccountShop = "system:shop"
+)
+
+const userAccountPrefix = "user:"
+
+// UserAccount - счёт пользователя в главной книге.
+func UserAccount(username string) string {
+	return userAccountPrefix + username
+}
+
+// Виды проводок.
+const (
+	EntryOpening  = "opening"
+	EntryWelcome  = "welcome"
+	EntryPurchase = "purchase"
+	EntryRefund   = "refund"
+	EntryTransfer = "transfer"
+)
+
+// ErrUnbalancedEntry возвращает PostJournalEntry, если строки проводки
+// не сходятся в ноль.
+var ErrUnbalancedEntry = errors.New("journal entry postings must sum to zero")
+
+// Posting - строка проводки: изменение баланса счёта. Списание отрицательно.
+type Posting struct {
+	Account string
+	Amount  int64
+}
+
+// JournalEntry - проводка: движение монет между счетами. Reference связывает
+// её с источником, например "order:42".
+type JournalEntry struct {
+	ID        int64
+	Kind      string
+	Reference string
+	CreatedAt time.Time
+	Postings  []Posting
+}
+
+// Validate проверяет, что проводка сходится: не меньше двух ненулевых строк
+// с нулевой суммой.
+func (e JournalEntry) Validate() error {
+	if e.Kind == "" {
+		return fmt.Errorf("%w: kind is required", ErrUnbalancedEntry)
+	}
+	if len(e.Postings) < 2 {
+		return fmt.Errorf("%w: at least two postings are required", ErrUnbalancedEntry)
+	}
+	var sum int64
+	for _, p := range e.Postings {
+		if p.Account == "" || p.Amount == 0 {
+			return fmt.Errorf("%w: posting needs an account and a non-zero amount", ErrUnbalancedEntry)
+		}
+		sum += p.Amount
+	}
+	if sum != 0 {
+		return fmt.Errorf("%w: sum is %d", ErrUnbalancedEntry, sum)
+	}
+	return nil
+}
+
+// Users возвращает пользователей, чьи счета затрагивает проводка, по имени.
+func (e JournalEntry) Users() []string {
+	var users []string
+	for _, p := range e.Postings {
+		if username, ok := PostingUser(p.Account); ok && !slices.Contains(users, username) {
+			users = append(users, username)
+		}
+	}
+	slices.Sort(users)
+	return users
+}
+
+// PostingUser возвращает пользователя, которому принадлежит счёт.
+func PostingUser(account string) (string, bool) {
+	return strings.CutPrefix(account, userAccountPrefix)
+}
+
+// PostJournalEntry записывает проводку и обновляет кеш users.balance для
+// счетов пользователей. Если баланс ушёл бы в минус - ErrLowBalance, если
+// списание идёт с замороженного счёта - ErrAccountFrozen. Строки проводки
+// сверяются при COMMIT, поэтому conn должен быть транзакцией из InTx.
+func (r *DB) PostJournalEntry(ctx context.Context, entry JournalEntry, conn Querier) (*JournalEntry, error) {
+
+	if err := entry.Validate(); err != nil {
+		return nil, err
+	}
+	// Строки пользователей блокируются в порядке имён до любых изменений,
+	// поэтому встречные переводы ждут друг друга, а не попадают в deadlock.
+	if users := entry.Users(); len(users) > 0 {
+		q := "SELECT username FROM users WHERE username = ANY($1) ORDER BY username FOR UPDATE"
+		if _, err := conn.Exec(ctx, q, users); err != nil {
+			return nil, fmt.Errorf("failed to lock users: %w", err)
+		}
+	}
+
+	q := "INSERT INTO journal_entries (kind, reference) VALUES ($1, $2) RETURNING id, created_at"
+	if err := conn.QueryRow(ctx, q, entry.Kind, entry.Reference).Scan(&entry.ID, &entry.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to INSERT INTO journal_entries: %w", err)
+	}
+
+	for _, p := range entry.Postings {
+		q := "INSERT INTO postings (entry_id, account_id, amount) VALUES ($1, $2, $3)"
+		if _, err := conn.Exec(ctx, q, entry.ID, p.Account, p.Amount); err != nil {
+			return nil, fmt.Errorf("failed to INSERT INTO postings: %w", err)
+		}
+
+		username, ok := PostingUser(p.Account)
+		if !ok {
+			continue
+		}
+		// Списание с замороженного счёта не обновит ни одной строки.
+		q = "UPDATE users SET balance = balance + $1 WHERE username = $2 AND ($1 > 0 OR NOT frozen)"
+		tag, err := conn.Exec(ctx, q, p.Amount, username)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.ConstraintName == "users_balance_non_negative" {
+				return nil, ErrLowBalance
+			}
+			return nil, fmt.Errorf("failed to update user balance: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return nil, ErrAccountFrozen
+		}
+	}
+	return &entry, nil
+}
+
+// openUserAccount заводит счёт пользователя и зачисляет на него
+// приветственные монеты user.Balance со счёта AccountIssuance.
+func (r *DB) openUserAccount(ctx context.Context, user User, conn Querier) error {
+
+	q := "INSERT INTO ledger_accounts (id, kind, username) VALUES ($1, 'user', $2)"
+	if _, err := conn.Exec(ctx, q, UserAccount(user.Username), user.Username); err != nil {
+		return fmt.Errorf("failed to INSERT INTO ledger_accounts: %w", err)
+	}
+	if user.Balance == 0 {
+		return nil
+	}
+	_, err := r.PostJournalEntry(ctx, JournalEntry{
+		Kind:      EntryWelcome,
+		Reference: UserAccount(user.Username),
+		Postings: []Posting{
+			{Account: AccountIssuance, Amount: -user.Balance},
+			{Account: UserAccount(user.Username), Amount: user.Balance},
+		},
+	}, conn)
+	return err
+}
+
+// GetLedgerBalance возвращает баланс счёта по строкам проводок.
+func (r *DB) GetLedgerBalance(ctx context.Context, account string) (int64, error) {
+
+	q := "SELECT COALESCE(SUM(amount), 0)::BIGINT FROM postings WHERE account_id = $1"
+	var balance int64
+	if err := r.DBPool.QueryRow(ctx, q, account).Scan(&balance); err != nil {
+		return 0, fmt.Errorf("failed to query ledger balance: %w", err)
+	}
+	return balance, nil
+}
+
+func (t *pgTx) PostJournalEntry(ctx context.Context, entry JournalEntry) (*JournalEntry, error) {
+	return t.db.PostJournalEntry(ctx, entry, t.tx)
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// LoginFailure - счётчик неудачных входов по ключу (имени пользователя или IP).
+type LoginFailure struct {
+	Key         string
+	Failures    int
+	LockedUntil *time.Time
+	UpdatedAt   time.Time
+}
+
+func (r *DB) GetLoginFailure(ctx context.Context, key string) (*LoginFailure, error) {
+
+	q := "SELECT key, failures, locked_until, updated_at FROM login_failures WHERE key = $1"
+	row := r.DBPool.QueryRow(ctx, q, key)
+
+	var lf LoginFailure
+	if err := row.Scan(&lf.Key, &lf.Failures, &lf.LockedUntil, &lf.UpdatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query login failure: %w", err)
+	}
+	return &lf, nil
+}
+
+// AddLoginFailure увеличивает счётчик и возвращает новое значение. Счётчик,
+// который не менялся дольше window, начинается заново.
+func (r *DB) AddLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+
+	q := `
+		INSERT INTO login_failures (key, failures, updated_at) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_failures.updated_at < $3 THEN 1 ELSE login_failures.failures + 1 END,
+			updated_at = $2
+		RETURNING failures
+	`
+	var failures int
+	if err := r.DBPool.QueryRow(ctx, q, key, now, now.Add(-window)).Scan(&failures); err != nil {
+		return 0, fmt.Errorf("failed to record login failure: %w", err)
+	}
+	return failures, nil
+}
+
+func (r *DB) LockLogin(ctx context.Context, key string, until time.Time) error {
+
+	q := "UPDATE login_failures SET locked_until = $2 WHERE key = $1"
+	if _, err := r.DBPool.Exec(ctx, q, key, until); err != nil {
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+	return nil
+}
+
+func (r *DB) ResetLoginFailures(ctx context.Context, key string) error {
+
+	q := "DELETE FROM login_failures WHERE key = $1"
+	if _, err := r.DBPool.Exec(ctx, q, key); err != nil {
+		return fmt.Errorf("failed to reset login failures: %w", err)
+	}
+	return nil
+}
+
+// DeleteStaleLoginFailures удаляет счётчики, которые не менялись дольше window
+// и не держат блокировку, и возвращает их число. AddLoginFailure такие
+// счётчики всё равно начал бы заново.
+func (r *DB) DeleteStaleLoginFailures(ctx context.Context, now time.Time, window time.Duration) (int64, error) {
+
+	q := "DELETE FROM login_failures WHERE updated_at < $1 AND (locked_until IS NULL OR locked_until <= $2)"
+	tag, err := r.DBPool.Exec(ctx, q, now.Add(-window), now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete stale login failures: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
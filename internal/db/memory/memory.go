@@ -0,0 +1,992 @@
+// Package memory содержит реализацию db.Storage в памяти процесса.
+// Она повторяет ограничения схемы Postgres (уникальность пользователей,
+// неотрицательный баланс, внешние ключи), поэтому подходит для тестов
+// обработчиков и e2e-сценариев без базы данных.
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/titoffon/merch-store/internal/db"
+)
+
+// DefaultMerch - стартовый каталог, тот же, что сеется миграцией.
+var DefaultMerch = map[string]int64{
+	"t-shirt":    80,
+	"cup":        20,
+	"book":       50,
+	"pen":        10,
+	"powerbank":  200,
+	"hoody":      300,
+	"umbrella":   200,
+	"socks":      10,
+	"wallet":     50,
+	"pink-hoody": 500,
+}
+
+var errTxDone = errors.New("transaction has already been committed or rolled back")
+
+type idempotencyKey struct {
+	username string
+	key      string
+}
+
+// storedPurchase - строка покупки со временем, которое в Postgres
+// проставляет DEFAULT.
+type storedPurchase struct {
+	db.Purchases
+	createdAt time.Time
+}
+
+// storedTransfer - перевод вместе с реакцией получателя.
+type storedTransfer struct {
+	db.TransactionLog
+	reaction string
+}
+
+type state struct {
+	users     map[string]db.User
+	merch     map[string]db.MerchItem
+	orders    []db.Order
+	purchases []storedPurchase
+	refunds   []db.Refund
+	transfers []storedTransfer
+	tokens    map[string]db.RefreshToken
+	failures  map[string]db.LoginFailure
+	idemp     map[idempotencyKey]db.IdempotencyRecord
+	accounts  map[string]struct{}
+	entries   []db.JournalEntry
+	audit     []db.AuditEntry
+	jobRuns   map[jobRun]struct{}
+}
+
+type jobRun struct {
+	job  string
+	slot time.Time
+}
+
+func (s *state) clone() *state {
+	c := &state{
+		users:     make(map[string]db.User, len(s.users)),
+		merch:     make(map[string]db.MerchItem, len(s.merch)),
+		orders:    append([]db.Order(nil), s.orders...),
+		purchases: append([]storedPurchase(nil), s.purchases...),
+		refunds:   append([]db.Refund(nil), s.refunds...),
+		transfers: append([]storedTransfer(nil), s.transfers...),
+		audit:     append([]db.AuditEntry(nil), s.audit...),
+		tokens:    make(map[string]db.RefreshToken, len(s.tokens)),
+		failures:  make(map[string]db.LoginFailure, len(s.failures)),
+		idemp:     make(map[idempotencyKey]db.IdempotencyRecord, len(s.idemp)),
+		accounts:  make(map[string]struct{}, len(s.accounts)),
+		entries:   append([]db.JournalEntry(nil), s.entries...),
+		jobRuns:   make(map[jobRun]struct{}, len(s.jobRuns)),
+	}
+	for k, v := range s.users {
+		c.users[k] = v
+	}
+	for k, v := range s.tokens {
+		c.tokens[k] = v
+	}
+	for k, v := range s.failures {
+		c.failures[k] = v
+	}
+	for k, v := range s.merch {
+		c.merch[k] = v
+	}
+	for k, v := range s.idemp {
+		c.idemp[k] = v
+	}
+	for k := range s.accounts {
+		c.accounts[k] = struct{}{}
+	}
+	for k := range s.jobRuns {
+		c.jobRuns[k] = struct{}{}
+	}
+	return c
+}
+
+// order возвращает копию заказа со строками или nil, если заказа нет.
+func (s *state) order(id int64) *db.Order {
+	if id < 1 || id > int64(len(s.orders)) {
+		return nil
+	}
+	o := s.orders[id-1]
+	for _, p := range s.purchases {
+		if p.OrderID == id {
+			o.Lines = append(o.Lines, db.OrderLine{Item: p.Merch_item, Quantity: p.Quantity, Price: p.Price})
+		}
+	}
+	sort.Slice(o.Lines, func(i, j int) bool { return o.Lines[i].Item < o.Lines[j].Item })
+	return &o
+}
+
+func (s *state) cancelled(orderID int64) bool {
+	return orderID != 0 && s.orders[orderID-1].Status == db.OrderCancelled
+}
+
+// post записывает проводку и обновляет балансы пользователей. Проводка
+// применяется целиком или не применяется вовсе.
+func (s *state) post(entry db.JournalEntry) (*db.JournalEntry, error) {
+	if err := entry.Validate(); err != nil {
+		return nil, err
+	}
+	balances := make(map[string]int64)
+	for _, p := range entry.Postings {
+		if _, ok := s.accounts[p.Account]; !ok {
+			return nil, fmt.Errorf("failed to INSERT INTO postings: unknown account %q", p.Account)
+		}
+		username, ok := db.PostingUser(p.Account)
+		if !ok {
+			continue
+		}
+		if p.Amount < 0 && s.users[username].Frozen {
+			return nil, db.ErrAccountFrozen
+		}
+		if _, seen := balances[username]; !seen {
+			balances[username] = s.users[username].Balance
+		}
+		balances[username] += p.Amount
+	}
+	for username, balance := range balances {
+		if balance < 0 {
+			return nil, db.ErrLowBalance
+		}
+		user := s.users[username]
+		user.Balance = balance
+		s.users[username] = user
+	}
+
+	entry.ID = int64(len(s.entries) + 1)
+	entry.CreatedAt = time.Now()
+	entry.Postings = append([]db.Posting(nil), entry.Postings...)
+	s.entries = append(s.entries, entry)
+	return &entry, nil
+}
+
+// Store хранит данные магазина в памяти. Транзакции выполняются строго
+// по очереди: Begin захватывает хранилище до Commit или Rollback, поэтому
+// внутри транзакции нельзя обращаться к самому Store из той же горутины.
+type Store struct {
+	mu    sync.Mutex
+	st    *state
+	locks map[string]struct{}
+}
+
+var _ db.Storage = (*Store)(nil)
+
+// New создаёт пустое хранилище с каталогом DefaultMerch.
+func New() *Store {
+	st := &state{
+		users:    make(map[string]db.User),
+		merch:    make(map[string]db.MerchItem, len(DefaultMerch)),
+		tokens:   make(map[string]db.RefreshToken),
+		failures: make(map[string]db.LoginFailure),
+		idemp:    make(map[idempotencyKey]db.IdempotencyRecord),
+		accounts: map[string]struct{}{db.AccountIssuance: {}, db.AccountShop: {}},
+		jobRuns:  make(map[jobRun]struct{}),
+	}
+	for name, price := range DefaultMerch {
+		st.merch[name] = db.MerchItem{Name: name, Price: price, Active: true}
+	}
+	return &Store{st: st, locks: make(map[string]struct{})}
+}
+
+func (s *Store) Close() {}
+
+func (s *Store) GetUserByName(_ context.Context, name string) (*db.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.st.users[name]
+	if !ok {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+func (s *Store) CreateUser(_ context.Context, user db.User) (*db.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.st.users[user.Username]; ok {
+		return nil, db.ErrUserExists
+	}
+	if user.Balance < 0 {
+		return nil, db.ErrLowBalance
+	}
+	welcome := user.Balance
+	user.Balance = 0
+	s.st.users[user.Username] = user
+	s.st.accounts[db.UserAccount(user.Username)] = struct{}{}
+	if welcome > 0 {
+		_, err := s.st.post(db.JournalEntry{
+			Kind:      db.EntryWelcome,
+			Reference: db.UserAccount(user.Username),
+			Postings: []db.Posting{
+				{Account: db.AccountIssuance, Amount: -welcome},
+				{Account: db.UserAccount(user.Username), Amount: welcome},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	user.Balance = welcome
+	return &user, nil
+}
+
+func (s *Store) SetUserRoles(_ context.Context, username string, roles []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.st.users[username]
+	if !ok {
+		return db.ErrUserNotFound
+	}
+	user.Roles = append([]string(nil), roles...)
+	s.st.users[username] = user
+	return nil
+}
+
+func (s *Store) GetMerchItem(_ context.Context, name string) (*db.MerchItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.st.merch[name]
+	if !ok {
+		return nil, nil
+	}
+	return &item, nil
+}
+
+func (s *Store) ListMerchItems(_ context.Context, filter db.MerchFilter) ([]db.MerchItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !db.ValidMerchSort(filter.Sort) {
+		return nil, fmt.Errorf("unknown merch sort %q", filter.Sort)
+	}
+
+	var items []db.MerchItem
+	for _, item := range s.st.merch {
+		switch {
+		case !item.Active && !filter.IncludeArchived,
+			filter.MinPrice != 0 && item.Price < filter.MinPrice,
+			filter.MaxPrice != 0 && item.Price > filter.MaxPrice,
+			filter.Category != "" && item.Category != filter.Category:
+			continue
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		switch {
+		case filter.Sort == db.MerchSortPrice && a.Price != b.Price:
+			return a.Price < b.Price
+		case filter.Sort == db.MerchSortPriceDesc && a.Price != b.Price:
+			return a.Price > b.Price
+		}
+		return a.Name < b.Name
+	})
+	return items, nil
+}
+
+func (s *Store) ListAuditEntries(_ context.Context, target string, limit int) ([]db.AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []db.AuditEntry
+	for i := len(s.st.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		if s.st.audit[i].Target == target {
+			entries = append(entries, s.st.audit[i])
+		}
+	}
+	return entries, nil
+}
+
+func (s *Store) GetOrder(_ context.Context, id int64) (*db.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.st.order(id), nil
+}
+
+func (s *Store) ListOrders(_ context.Context, filter db.OrderFilter) ([]db.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var orders []db.Order
+	for i := len(s.st.orders) - 1; i >= 0; i-- {
+		o := s.st.orders[i]
+		if filter.Username != "" && o.Username != filter.Username {
+			continue
+		}
+		if filter.Status != "" && o.Status != filter.Status {
+			continue
+		}
+		orders = append(orders, *s.st.order(o.ID))
+		if filter.Limit > 0 && len(orders) == filter.Limit {
+			break
+		}
+	}
+	return orders, nil
+}
+
+func (s *Store) GetUserPurchases(_ context.Context, username string) ([]db.PurchaseCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]*db.PurchaseCount)
+	for _, p := range s.st.purchases {
+		if p.Username != username || s.st.cancelled(p.OrderID) {
+			continue
+		}
+		pc, ok := counts[p.Merch_item]
+		if !ok {
+			pc = &db.PurchaseCount{MerchItem: p.Merch_item}
+			counts[p.Merch_item] = pc
+		}
+		pc.Quantity += p.Quantity
+		pc.Details = append(pc.Details, db.PurchaseDetail{
+			OrderID:     p.OrderID,
+			Quantity:    p.Quantity,
+			Price:       p.Price,
+			Currency:    p.Currency,
+			PurchasedAt: p.createdAt,
+		})
+	}
+
+	var results []db.PurchaseCount
+	for _, pc := range counts {
+		results = append(results, *pc)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].MerchItem < results[j].MerchItem })
+	return results, nil
+}
+
+func (s *Store) GetUserRefunds(_ context.Context, username string) ([]db.Refund, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var refunds []db.Refund
+	for i := len(s.st.refunds) - 1; i >= 0; i-- {
+		if s.st.refunds[i].Username == username {
+			refunds = append(refunds, s.st.refunds[i])
+		}
+	}
+	return refunds, nil
+}
+
+func (s *Store) GetLedgerBalance(_ context.Context, account string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var balance int64
+	for _, e := range s.st.entries {
+		for _, p := range e.Postings {
+			if p.Account == account {
+				balance += p.Amount
+			}
+		}
+	}
+	return balance, nil
+}
+
+func (s *Store) ListBalanceHistory(_ context.Context) ([]db.BalanceHistory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := make(map[string]*db.BalanceHistory, len(s.st.users))
+	for name, u := range s.st.users {
+		history[name] = &db.BalanceHistory{Username: name, Balance: u.Balance, Frozen: u.Frozen}
+	}
+	for _, e := range s.st.entries {
+		for _, p := range e.Postings {
+			if username, ok := db.PostingUser(p.Account); ok {
+				history[username].Ledger += p.Amount
+				if e.Kind == db.EntryWelcome || e.Kind == db.EntryOpening {
+					history[username].Opening += p.Amount
+				}
+			}
+		}
+	}
+	for _, t := range s.st.transfers {
+		history[t.Recipient].Received += t.Amount
+		history[t.Sender].Sent += t.Amount
+	}
+	for _, p := range s.st.purchases {
+		history[p.Username].Spent += p.Quantity * p.Price
+	}
+	for _, r := range s.st.refunds {
+		history[r.Username].Refunded += r.Amount
+	}
+
+	results := make([]db.BalanceHistory, 0, len(history))
+	for _, h := range history {
+		results = append(results, *h)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Username < results[j].Username })
+	return results, nil
+}
+
+func (s *Store) GetTransactionsReceived(_ context.Context, username string) ([]db.ReceivedTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var results []db.ReceivedTransaction
+	for i := len(s.st.transfers) - 1; i >= 0; i-- {
+		t := s.st.transfers[i]
+		if t.Recipient == username {
+			results = append(results, db.ReceivedTransaction{
+				ID:       t.ID,
+				FromUser: t.Sender,
+				Amount:   t.Amount,
+				Message:  t.Message,
+				Category: t.Category,
+				Reaction: t.reaction,
+			})
+		}
+	}
+	return results, nil
+}
+
+func (s *Store) GetTransactionsSent(_ context.Context, username string) ([]db.SentTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var results []db.SentTransaction
+	for i := len(s.st.transfers) - 1; i >= 0; i-- {
+		t := s.st.transfers[i]
+		if t.Sender == username {
+			results = append(results, db.SentTransaction{
+				ID:       t.ID,
+				ToUser:   t.Recipient,
+				Amount:   t.Amount,
+				Message:  t.Message,
+				Category: t.Category,
+				Reaction: t.reaction,
+			})
+		}
+	}
+	return results, nil
+}
+
+func (s *Store) SetTransferReaction(_ context.Context, id int64, recipient, reaction string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.st.transfers {
+		if t := &s.st.transfers[i]; t.ID == id && t.Recipient == recipient {
+			t.reaction = reaction
+			return nil
+		}
+	}
+	return db.ErrTransferNotFound
+}
+
+func (s *Store) GetRefreshToken(_ context.Context, tokenHash string) (*db.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.st.tokens[tokenHash]
+	if !ok {
+		return nil, nil
+	}
+	return &rt, nil
+}
+
+func (s *Store) RevokeRefreshTokenFamily(_ context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for hash, rt := range s.st.tokens {
+		if rt.FamilyID == familyID && rt.RevokedAt == nil {
+			rt.RevokedAt = &now
+			s.st.tokens[hash] = rt
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetLoginFailure(_ context.Context, key string) (*db.LoginFailure, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lf, ok := s.st.failures[key]
+	if !ok {
+		return nil, nil
+	}
+	return &lf, nil
+}
+
+func (s *Store) AddLoginFailure(_ context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lf, ok := s.st.failures[key]
+	if !ok || lf.UpdatedAt.Before(now.Add(-window)) {
+		lf.Key, lf.Failures = key, 0
+	}
+	lf.Failures++
+	lf.UpdatedAt = now
+	s.st.failures[key] = lf
+	return lf.Failures, nil
+}
+
+func (s *Store) LockLogin(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lf, ok := s.st.failures[key]; ok {
+		lf.LockedUntil = &until
+		s.st.failures[key] = lf
+	}
+	return nil
+}
+
+func (s *Store) ResetLoginFailures(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.st.failures, key)
+	return nil
+}
+
+func (s *Store) DeleteStaleLoginFailures(_ context.Context, now time.Time, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for k, lf := range s.st.failures {
+		if lf.UpdatedAt.Before(now.Add(-window)) && (lf.LockedUntil == nil || !lf.LockedUntil.After(now)) {
+			delete(s.st.failures, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *Store) ReserveIdempotencyKey(_ context.Context, rec db.IdempotencyRecord, now time.Time) (*db.IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idempotencyKey{rec.Username, rec.Key}
+	if existing, ok := s.st.idemp[k]; ok && existing.ExpiresAt.After(now) {
+		return &existing, false, nil
+	}
+	rec.StatusCode, rec.ContentType, rec.Response = 0, "", nil
+	s.st.idemp[k] = rec
+	return &rec, true, nil
+}
+
+func (s *Store) CompleteIdempotencyKey(_ context.Context, rec db.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idempotencyKey{rec.Username, rec.Key}
+	existing, ok := s.st.idemp[k]
+	if !ok {
+		return nil
+	}
+	existing.StatusCode = rec.StatusCode
+	existing.ContentType = rec.ContentType
+	existing.Response = append([]byte(nil), rec.Response...)
+	s.st.idemp[k] = existing
+	return nil
+}
+
+func (s *Store) ReleaseIdempotencyKey(_ context.Context, username, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.st.idemp, idempotencyKey{username, key})
+	return nil
+}
+
+func (s *Store) DeleteExpiredIdempotencyKeys(_ context.Context, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for k, rec := range s.st.idemp {
+		if !rec.ExpiresAt.After(now) {
+			delete(s.st.idemp, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// TryLock берёт блокировку name в пределах процесса.
+func (s *Store) TryLock(_ context.Context, name string) (func(), bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, held := s.locks[name]; held {
+		return nil, false, nil
+	}
+	s.locks[name] = struct{}{}
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.locks, name)
+	}, true, nil
+}
+
+func (s *Store) ClaimJobRun(_ context.Context, job string, slot time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := jobRun{job: job, slot: slot.UTC()}
+	if _, done := s.st.jobRuns[key]; done {
+		return false, nil
+	}
+	s.st.jobRuns[key] = struct{}{}
+	return true, nil
+}
+
+// Begin захватывает хранилище и отдаёт транзакции рабочую копию данных.
+func (s *Store) Begin(ctx context.Context) (db.Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	s.mu.Lock()
+	return &tx{store: s, st: s.st.clone()}, nil
+}
+
+// InTx выполняет fn в транзакции. Транзакции в памяти идут по очереди,
+// поэтому повторять их не нужно.
+func (s *Store) InTx(ctx context.Context, fn func(tx db.Tx) error) error {
+	t, err := s.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer t.Rollback(ctx)
+
+	if err := fn(t); err != nil {
+		return err
+	}
+	return t.Commit(ctx)
+}
+
+type tx struct {
+	store *Store
+	st    *state
+	done  bool
+}
+
+func (t *tx) PostJournalEntry(_ context.Context, entry db.JournalEntry) (*db.JournalEntry, error) {
+	if t.done {
+		return nil, errTxDone
+	}
+	return t.st.post(entry)
+}
+
+func (t *tx) SetUserFrozen(_ context.Context, username string, frozen bool) error {
+	if t.done {
+		return errTxDone
+	}
+	user, ok := t.st.users[username]
+	if !ok {
+		return db.ErrUserNotFound
+	}
+	user.Frozen = frozen
+	t.st.users[username] = user
+	return nil
+}
+
+func (t *tx) InsertOrder(_ context.Context, order db.Order) (*db.Order, error) {
+	if t.done {
+		return nil, errTxDone
+	}
+	if _, ok := t.st.users[order.Username]; !ok {
+		return nil, fmt.Errorf("failed to INSERT INTO orders: unknown user %q", order.Username)
+	}
+	if order.Total <= 0 {
+		return nil, fmt.Errorf("failed to INSERT INTO orders: total must be positive")
+	}
+	order.ID = int64(len(t.st.orders) + 1)
+	order.Status = db.OrderPlaced
+	order.CreatedAt = time.Now()
+	order.UpdatedAt = order.CreatedAt
+	lines := order.Lines
+	order.Lines = nil
+	t.st.orders = append(t.st.orders, order)
+	order.Lines = lines
+	return &order, nil
+}
+
+func (t *tx) GetOrderForUpdate(_ context.Context, id int64) (*db.Order, error) {
+	if t.done {
+		return nil, errTxDone
+	}
+	return t.st.order(id), nil
+}
+
+func (t *tx) SetOrderStatus(_ context.Context, id int64, status string) error {
+	if t.done {
+		return errTxDone
+	}
+	if id < 1 || id > int64(len(t.st.orders)) {
+		return db.ErrOrderNotFound
+	}
+	if !db.ValidOrderStatus(status) {
+		return fmt.Errorf("failed to update order status: unknown status %q", status)
+	}
+	t.st.orders[id-1].Status = status
+	t.st.orders[id-1].UpdatedAt = time.Now()
+	return nil
+}
+
+func (t *tx) InsertRefund(_ context.Context, refund db.Refund) error {
+	if t.done {
+		return errTxDone
+	}
+	if t.st.order(refund.OrderID) == nil {
+		return fmt.Errorf("failed to INSERT INTO refunds: unknown order %d", refund.OrderID)
+	}
+	if _, ok := t.st.users[refund.Username]; !ok {
+		return fmt.Errorf("failed to INSERT INTO refunds: unknown user %q", refund.Username)
+	}
+	if refund.Amount <= 0 {
+		return fmt.Errorf("failed to INSERT INTO refunds: amount must be positive")
+	}
+	for _, rf := range t.st.refunds {
+		if rf.OrderID == refund.OrderID {
+			return db.ErrAlreadyRefunded
+		}
+	}
+	refund.ID = int64(len(t.st.refunds) + 1)
+	refund.CreatedAt = time.Now()
+	t.st.refunds = append(t.st.refunds, refund)
+	return nil
+}
+
+func (t *tx) InsertPurchases(_ context.Context, purchase db.Purchases) error {
+	if t.done {
+		return errTxDone
+	}
+	if _, ok := t.st.users[purchase.Username]; !ok {
+		return fmt.Errorf("failed to INSERT INTO purchases: unknown user %q", purchase.Username)
+	}
+	if _, ok := t.st.merch[purchase.Merch_item]; !ok {
+		return fmt.Errorf("failed to INSERT INTO purchases: unknown item %q", purchase.Merch_item)
+	}
+	if purchase.OrderID != 0 && (purchase.OrderID < 1 || purchase.OrderID > int64(len(t.st.orders))) {
+		return fmt.Errorf("failed to INSERT INTO purchases: unknown order %d", purchase.OrderID)
+	}
+	if purchase.Quantity == 0 {
+		purchase.Quantity = 1
+	}
+	if purchase.Quantity < 0 {
+		return fmt.Errorf("failed to INSERT INTO purchases: quantity must be positive")
+	}
+	if purchase.Price <= 0 {
+		return fmt.Errorf("failed to INSERT INTO purchases: price must be positive")
+	}
+	if purchase.Currency == "" {
+		purchase.Currency = db.CurrencyCoin
+	}
+	t.st.purchases = append(t.st.purchases, storedPurchase{Purchases: purchase, createdAt: time.Now()})
+	return nil
+}
+
+func (t *tx) InsertTransaction_log(_ context.Context, transaction db.TransactionLog) (*db.TransactionLog, error) {
+	if t.done {
+		return nil, errTxDone
+	}
+	if _, ok := t.st.users[transaction.Sender]; !ok {
+		return nil, fmt.Errorf("failed to INSERT INTO transaction_log: unknown sender %q", transaction.Sender)
+	}
+	if _, ok := t.st.users[transaction.Recipient]; !ok {
+		return nil, fmt.Errorf("failed to INSERT INTO transaction_log: unknown recipient %q", transaction.Recipient)
+	}
+	if transaction.Amount <= 0 {
+		return nil, fmt.Errorf("failed to INSERT INTO transaction_log: amount must be positive")
+	}
+	if utf8.RuneCountInString(transaction.Message) > 200 {
+		return nil, fmt.Errorf("failed to INSERT INTO transaction_log: message is too long")
+	}
+	transaction.ID = int64(len(t.st.transfers)) + 1
+	t.st.transfers = append(t.st.transfers, storedTransfer{TransactionLog: transaction})
+	return &transaction, nil
+}
+
+func (t *tx) InsertRefreshToken(_ context.Context, token db.RefreshToken) error {
+	if t.done {
+		return errTxDone
+	}
+	if _, ok := t.st.users[token.Username]; !ok {
+		return fmt.Errorf("failed to INSERT INTO refresh_tokens: unknown user %q", token.Username)
+	}
+	if _, ok := t.st.tokens[token.TokenHash]; ok {
+		return fmt.Errorf("failed to INSERT INTO refresh_tokens: duplicate token")
+	}
+	token.CreatedAt = time.Now()
+	token.RevokedAt = nil
+	token.ReplacedBy = ""
+	t.st.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (t *tx) RevokeRefreshToken(_ context.Context, tokenHash, replacedBy string) (bool, error) {
+	if t.done {
+		return false, errTxDone
+	}
+	rt, ok := t.st.tokens[tokenHash]
+	if !ok || rt.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	rt.RevokedAt = &now
+	rt.ReplacedBy = replacedBy
+	t.st.tokens[tokenHash] = rt
+	return true, nil
+}
+
+func (t *tx) GetMerchItemForUpdate(_ context.Context, name string) (*db.MerchItem, error) {
+	if t.done {
+		return nil, errTxDone
+	}
+	item, ok := t.st.merch[name]
+	if !ok {
+		return nil, nil
+	}
+	return &item, nil
+}
+
+func (t *tx) InsertMerchItem(_ context.Context, item db.MerchItem) error {
+	if t.done {
+		return errTxDone
+	}
+	if _, ok := t.st.merch[item.Name]; ok {
+		return db.ErrItemExists
+	}
+	if item.Price <= 0 {
+		return fmt.Errorf("failed to INSERT INTO merch: price must be positive")
+	}
+	if item.Stock != nil {
+		if *item.Stock < 0 {
+			return fmt.Errorf("failed to INSERT INTO merch: stock must not be negative")
+		}
+		stock := *item.Stock
+		item.Stock = &stock
+	}
+	t.st.merch[item.Name] = item
+	return nil
+}
+
+func (t *tx) UpdateMerchItem(_ context.Context, item db.MerchItem) error {
+	if t.done {
+		return errTxDone
+	}
+	current, ok := t.st.merch[item.Name]
+	if !ok {
+		return db.ErrItemNotFound
+	}
+	if item.Price <= 0 {
+		return fmt.Errorf("failed to update merch: price must be positive")
+	}
+	item.Stock = current.Stock
+	t.st.merch[item.Name] = item
+	return nil
+}
+
+func (t *tx) TakeMerchStock(_ context.Context, name string, quantity int64) error {
+	if t.done {
+		return errTxDone
+	}
+	item, ok := t.st.merch[name]
+	if !ok {
+		return db.ErrItemNotFound
+	}
+	if item.Stock == nil {
+		return nil
+	}
+	if *item.Stock < quantity {
+		return db.ErrOutOfStock
+	}
+	stock := *item.Stock - quantity
+	item.Stock = &stock
+	t.st.merch[name] = item
+	return nil
+}
+
+func (t *tx) AddMerchStock(_ context.Context, name string, delta int64) (int64, error) {
+	if t.done {
+		return 0, errTxDone
+	}
+	item, ok := t.st.merch[name]
+	if !ok {
+		return 0, db.ErrItemNotFound
+	}
+	if item.Stock == nil {
+		return 0, db.ErrUnlimitedStock
+	}
+	stock := *item.Stock + delta
+	if stock < 0 {
+		return 0, fmt.Errorf("failed to add merch stock: stock must not be negative")
+	}
+	item.Stock = &stock
+	t.st.merch[name] = item
+	return stock, nil
+}
+
+func (t *tx) SetMerchStock(_ context.Context, name string, stock *int64) error {
+	if t.done {
+		return errTxDone
+	}
+	item, ok := t.st.merch[name]
+	if !ok {
+		return db.ErrItemNotFound
+	}
+	if stock != nil && *stock < 0 {
+		return fmt.Errorf("failed to set merch stock: stock must not be negative")
+	}
+	if stock != nil {
+		v := *stock
+		stock = &v
+	}
+	item.Stock = stock
+	t.st.merch[name] = item
+	return nil
+}
+
+func (t *tx) InsertAuditEntry(_ context.Context, entry db.AuditEntry) error {
+	if t.done {
+		return errTxDone
+	}
+	if entry.Details == nil {
+		entry.Details = []byte("{}")
+	}
+	entry.ID = int64(len(t.st.audit) + 1)
+	entry.CreatedAt = time.Now()
+	t.st.audit = append(t.st.audit, entry)
+	return nil
+}
+
+func (t *tx) Commit(_ context.Context) error {
+	if t.done {
+		return errTxDone
+	}
+	t.done = true
+	t.store.st = t.st
+	t.store.mu.Unlock()
+	return nil
+}
+
+func (t *tx) Rollback(_ context.Context) error {
+	if t.done {
+		return nil
+	}
+	t.done = true
+	t.store.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,255 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/titoffon/merch-store/internal/db"
+	"github.com/titoffon/merch-store/internal/db/memory"
+)
+
+func spend(ctx context.Context, tx db.Tx, username string, amount int64) error {
+	_, err := tx.PostJournalEntry(ctx, db.JournalEntry{
+		Kind: db.EntryPurchase,
+		Postings: []db.Posting{
+			{Account: db.UserAccount(username), Amount: -amount},
+			{Account: db.AccountShop, Amount: amount},
+		},
+	})
+	return err
+}
+
+func TestTxCommitAndRollback(t *testing.T) {
+	ctx := context.Background()
+	s := memory.New()
+
+	if _, err := s.CreateUser(ctx, db.User{Username: "bob", Balance: 100}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	tx, err := s.Begin(ctx)
+	if err != nil {
+		t.Fatalf("failed to begin: %v", err)
+	}
+	if err := spend(ctx, tx, "bob", 30); err != nil {
+		t.Fatalf("failed to spend coins: %v", err)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatalf("failed to rollback: %v", err)
+	}
+
+	user, _ := s.GetUserByName(ctx, "bob")
+	if user.Balance != 100 {
+		t.Errorf("expected balance 100 after rollback, got %d", user.Balance)
+	}
+
+	tx, err = s.Begin(ctx)
+	if err != nil {
+		t.Fatalf("failed to begin: %v", err)
+	}
+	if err := spend(ctx, tx, "bob", 30); err != nil {
+		t.Fatalf("failed to spend coins: %v", err)
+	}
+	if err := tx.InsertPurchases(ctx, db.Purchases{Username: "bob", Merch_item: "cup", Price: 20}); err != nil {
+		t.Fatalf("failed to insert purchase: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Errorf("rollback after commit should be a no-op, got %v", err)
+	}
+
+	user, _ = s.GetUserByName(ctx, "bob")
+	if user.Balance != 70 {
+		t.Errorf("expected balance 70 after commit, got %d", user.Balance)
+	}
+	purchases, _ := s.GetUserPurchases(ctx, "bob")
+	if len(purchases) != 1 || purchases[0].MerchItem != "cup" || purchases[0].Quantity != 1 ||
+		len(purchases[0].Details) != 1 || purchases[0].Details[0].Price != 20 || purchases[0].Details[0].Currency != db.CurrencyCoin {
+		t.Errorf("unexpected purchases: %v", purchases)
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	ctx := context.Background()
+	s := memory.New()
+
+	if _, err := s.CreateUser(ctx, db.User{Username: "bob", Balance: 10}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if _, err := s.CreateUser(ctx, db.User{Username: "bob", Balance: 10}); !errors.Is(err, db.ErrUserExists) {
+		t.Errorf("expected ErrUserExists for duplicate username, got %v", err)
+	}
+	if item, err := s.GetMerchItem(ctx, "unknown"); item != nil || err != nil {
+		t.Errorf("expected nil, nil for unknown item, got %v, %v", item, err)
+	}
+
+	tx, err := s.Begin(ctx)
+	if err != nil {
+		t.Fatalf("failed to begin: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := spend(ctx, tx, "bob", 11); !errors.Is(err, db.ErrLowBalance) {
+		t.Errorf("expected ErrLowBalance, got %v", err)
+	}
+	if err := tx.InsertPurchases(ctx, db.Purchases{Username: "bob", Merch_item: "unknown", Price: 10}); err == nil {
+		t.Error("expected error for unknown item")
+	}
+	if err := tx.InsertPurchases(ctx, db.Purchases{Username: "bob", Merch_item: "cup"}); err == nil {
+		t.Error("expected error for a purchase without a price")
+	}
+	if _, err := tx.InsertTransaction_log(ctx, db.TransactionLog{Sender: "bob", Recipient: "ghost", Amount: 1}); err == nil {
+		t.Error("expected error for unknown recipient")
+	}
+}
+
+func TestLoginFailures(t *testing.T) {
+	ctx := context.Background()
+	s := memory.New()
+	now := time.Now()
+
+	for want := 1; want <= 2; want++ {
+		got, err := s.AddLoginFailure(ctx, "user:bob", now, time.Minute)
+		if err != nil || got != want {
+			t.Fatalf("expected %d failures, got %d (%v)", want, got, err)
+		}
+	}
+	if err := s.LockLogin(ctx, "user:bob", now.Add(time.Minute)); err != nil {
+		t.Fatalf("failed to lock: %v", err)
+	}
+	lf, _ := s.GetLoginFailure(ctx, "user:bob")
+	if lf == nil || lf.LockedUntil == nil || !lf.LockedUntil.Equal(now.Add(time.Minute)) {
+		t.Errorf("unexpected login failure: %+v", lf)
+	}
+
+	if got, _ := s.AddLoginFailure(ctx, "user:bob", now.Add(2*time.Minute), time.Minute); got != 1 {
+		t.Errorf("expected counter to restart after the window, got %d", got)
+	}
+
+	if err := s.ResetLoginFailures(ctx, "user:bob"); err != nil {
+		t.Fatalf("failed to reset: %v", err)
+	}
+	if lf, _ := s.GetLoginFailure(ctx, "user:bob"); lf != nil {
+		t.Errorf("expected no failures after reset, got %+v", lf)
+	}
+}
+
+func TestOrders(t *testing.T) {
+	ctx := context.Background()
+	s := memory.New()
+	if _, err := s.CreateUser(ctx, db.User{Username: "bob", Balance: 100}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	tx, _ := s.Begin(ctx)
+	order, err := tx.InsertOrder(ctx, db.Order{Username: "bob", Total: 40})
+	if err != nil {
+		t.Fatalf("failed to insert order: %v", err)
+	}
+	for _, p := range []db.Purchases{
+		{Username: "bob", Merch_item: "pen", OrderID: order.ID, Quantity: 2, Price: 10},
+		{Username: "bob", Merch_item: "cup", OrderID: order.ID, Quantity: 1, Price: 20},
+	} {
+		if err := tx.InsertPurchases(ctx, p); err != nil {
+			t.Fatalf("failed to insert purchase: %v", err)
+		}
+	}
+	if err := tx.InsertPurchases(ctx, db.Purchases{Username: "bob", Merch_item: "pen", OrderID: 42, Price: 10}); err == nil {
+		t.Error("expected an error for an unknown order")
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	got, _ := s.GetOrder(ctx, order.ID)
+	if got == nil || got.Status != db.OrderPlaced || len(got.Lines) != 2 || got.Lines[1] != (db.OrderLine{Item: "pen", Quantity: 2, Price: 10}) {
+		t.Errorf("unexpected order: %+v", got)
+	}
+	if got, _ := s.GetOrder(ctx, 2); got != nil {
+		t.Errorf("expected no order, got %+v", got)
+	}
+
+	purchases, _ := s.GetUserPurchases(ctx, "bob")
+	if len(purchases) != 2 || purchases[1].Quantity != 2 {
+		t.Errorf("expected quantities to be summed, got %v", purchases)
+	}
+
+	tx, _ = s.Begin(ctx)
+	if err := tx.SetOrderStatus(ctx, 2, db.OrderReady); !errors.Is(err, db.ErrOrderNotFound) {
+		t.Errorf("expected ErrOrderNotFound, got %v", err)
+	}
+	if err := tx.SetOrderStatus(ctx, order.ID, db.OrderReady); err != nil {
+		t.Fatalf("failed to set status: %v", err)
+	}
+	tx.Commit(ctx)
+
+	orders, _ := s.ListOrders(ctx, db.OrderFilter{Status: db.OrderReady})
+	if len(orders) != 1 || orders[0].ID != order.ID {
+		t.Errorf("unexpected orders: %+v", orders)
+	}
+
+	tx, _ = s.Begin(ctx)
+	if err := tx.InsertRefund(ctx, db.Refund{OrderID: order.ID, Username: "bob", Amount: 40}); err != nil {
+		t.Fatalf("failed to insert refund: %v", err)
+	}
+	if err := tx.InsertRefund(ctx, db.Refund{OrderID: order.ID, Username: "bob", Amount: 40}); !errors.Is(err, db.ErrAlreadyRefunded) {
+		t.Errorf("expected ErrAlreadyRefunded, got %v", err)
+	}
+	if err := tx.SetOrderStatus(ctx, order.ID, db.OrderCancelled); err != nil {
+		t.Fatalf("failed to set status: %v", err)
+	}
+	tx.Commit(ctx)
+
+	if purchases, _ := s.GetUserPurchases(ctx, "bob"); len(purchases) != 0 {
+		t.Errorf("expected cancelled orders to leave the inventory, got %v", purchases)
+	}
+	if refunds, _ := s.GetUserRefunds(ctx, "bob"); len(refunds) != 1 || refunds[0].Amount != 40 {
+		t.Errorf("unexpected refunds: %+v", refunds)
+	}
+}
+
+func TestLedger(t *testing.T) {
+	ctx := context.Background()
+	s := memory.New()
+	if _, err := s.CreateUser(ctx, db.User{Username: "bob", Balance: 100}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	tx, _ := s.Begin(ctx)
+	defer tx.Rollback(ctx)
+	unbalanced := db.JournalEntry{Kind: db.EntryTransfer, Postings: []db.Posting{
+		{Account: db.UserAccount("bob"), Amount: -10},
+		{Account: db.AccountShop, Amount: 5},
+	}}
+	if _, err := tx.PostJournalEntry(ctx, unbalanced); !errors.Is(err, db.ErrUnbalancedEntry) {
+		t.Errorf("expected ErrUnbalancedEntry, got %v", err)
+	}
+	unknown := db.JournalEntry{Kind: db.EntryTransfer, Postings: []db.Posting{
+		{Account: db.UserAccount("bob"), Amount: -10},
+		{Account: db.UserAccount("ghost"), Amount: 10},
+	}}
+	if _, err := tx.PostJournalEntry(ctx, unknown); err == nil {
+		t.Error("expected an error for an unknown account")
+	}
+	if err := spend(ctx, tx, "bob", 25); err != nil {
+		t.Fatalf("failed to spend coins: %v", err)
+	}
+	tx.Commit(ctx)
+
+	for account, want := range map[string]int64{
+		db.UserAccount("bob"): 75,
+		db.AccountShop:        25,
+		db.AccountIssuance:    -100,
+	} {
+		if got, err := s.GetLedgerBalance(ctx, account); err != nil || got != want {
+			t.Errorf("expected %s balance %d, got %d (%v)", account, want, got, err)
+		}
+	}
+	if user, _ := s.GetUserByName(ctx, "bob"); user.Balance != 75 {
+		t.Errorf("expected cached balance 75, got %d", user.Balance)
+	}
+}
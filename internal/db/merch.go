@@ -0,0 +1,262 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrItemExists возвращает InsertMerchItem, если товар с таким именем уже есть.
+var ErrItemExists = errors.New("item already exists")
+
+// ErrOutOfStock возвращает TakeMerchStock, если товара на складе не хватает.
+var ErrOutOfStock = errors.New("item is out of stock")
+
+// ErrUnlimitedStock возвращает AddMerchStock для товара без учёта остатка.
+var ErrUnlimitedStock = errors.New("item has unlimited stock")
+
+// MerchItem - карточка товара. Имя служит ключом и не меняется.
+type MerchItem struct {
+	Name        string
+	Price       int64
+	Description string
+	Category    string
+	ImageURL    string
+	Active      bool
+	// Stock - остаток на складе; nil - товар не ограничен.
+	Stock *int64
+}
+
+// CurrencyCoin - валюта цен каталога: внутренние монеты.
+const CurrencyCoin = "coin"
+
+// Available сообщает, можно ли сейчас купить товар.
+func (m MerchItem) Available() bool {
+	return m.Active && (m.Stock == nil || *m.Stock > 0)
+}
+
+// Порядок сортировки каталога. По умолчанию - по имени.
+const (
+	MerchSortName      = "name"
+	MerchSortPrice     = "price"
+	MerchSortPriceDesc = "-price"
+)
+
+type MerchFilter struct {
+	// IncludeArchived добавляет в выборку снятые с продажи товары.
+	IncludeArchived bool
+	// MinPrice и MaxPrice ограничивают цену включительно; ноль - без ограничения.
+	MinPrice int64
+	MaxPrice int64
+	Category string
+	Sort     string
+}
+
+// merchOrderBy - допустимые значения MerchFilter.Sort. В запрос подставляются
+// только они, поэтому пользовательский ввод в SQL не попадает.
+var merchOrderBy = map[string]string{
+	"":                 "name",
+	MerchSortName:      "name",
+	MerchSortPrice:     "price, name",
+	MerchSortPriceDesc: "price DESC, name",
+}
+
+// ValidMerchSort сообщает, поддерживается ли порядок сортировки.
+func ValidMerchSort(sort string) bool {
+	_, ok := merchOrderBy[sort]
+	return ok
+}
+
+const merchColumns = "name, price, description, category, image_url, active, stock"
+
+func scanMerchItem(row pgx.Row) (*MerchItem, error) {
+	var item MerchItem
+	err := row.Scan(&item.Name, &item.Price, &item.Description, &item.Category, &item.ImageURL, &item.Active, &item.Stock)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetMerchItem возвращает nil, nil, если товара нет.
+func (r *DB) GetMerchItem(ctx context.Context, name string) (*MerchItem, error) {
+
+	q := "SELECT " + merchColumns + " FROM merch WHERE name = $1"
+	item, err := scanMerchItem(r.DBPool.QueryRow(ctx, q, name))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query merch item: %w", err)
+	}
+	return item, nil
+}
+
+func (r *DB) ListMerchItems(ctx context.Context, filter MerchFilter) ([]MerchItem, error) {
+
+	orderBy, ok := merchOrderBy[filter.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown merch sort %q", filter.Sort)
+	}
+	q := "SELECT " + merchColumns + ` FROM merch
+		WHERE (active OR $1)
+			AND ($2 = 0 OR price >= $2)
+			AND ($3 = 0 OR price <= $3)
+			AND ($4 = '' OR category = $4)
+		ORDER BY ` + orderBy
+	rows, err := r.DBPool.Query(ctx, q, filter.IncludeArchived, filter.MinPrice, filter.MaxPrice, filter.Category)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query merch: %w", err)
+	}
+	defer rows.Close()
+
+	var items []MerchItem
+	for rows.Next() {
+		item, err := scanMerchItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan merch: %w", err)
+		}
+		items = append(items, *item)
+	}
+	return items, rows.Err()
+}
+
+// GetMerchItemForUpdate читает товар и блокирует строку до конца транзакции.
+func (r *DB) GetMerchItemForUpdate(ctx context.Context, name string, conn Querier) (*MerchItem, error) {
+
+	q := "SELECT " + merchColumns + " FROM merch WHERE name = $1 FOR UPDATE"
+	row := conn.QueryRow(ctx, q, name)
+	item, err := scanMerchItem(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query merch item: %w", err)
+	}
+	return item, nil
+}
+
+func (r *DB) InsertMerchItem(ctx context.Context, item MerchItem, conn Querier) error {
+
+	q := `
+		INSERT INTO merch (name, price, description, category, image_url, active, stock)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (name) DO NOTHING
+	`
+	args := []any{item.Name, item.Price, item.Description, item.Category, item.ImageURL, item.Active, item.Stock}
+	tag, err := conn.Exec(ctx, q, args...)
+	if err != nil {
+		return fmt.Errorf("failed to INSERT INTO merch: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrItemExists
+	}
+	return nil
+}
+
+// UpdateMerchItem перезаписывает карточку товара item.Name. Остаток не
+// меняется: для него есть TakeMerchStock, AddMerchStock и SetMerchStock.
+func (r *DB) UpdateMerchItem(ctx context.Context, item MerchItem, conn Querier) error {
+
+	q := `
+		UPDATE merch
+		SET price = $2, description = $3, category = $4, image_url = $5, active = $6
+		WHERE name = $1
+	`
+	args := []any{item.Name, item.Price, item.Description, item.Category, item.ImageURL, item.Active}
+	tag, err := conn.Exec(ctx, q, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update merch: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrItemNotFound
+	}
+	return nil
+}
+
+// TakeMerchStock списывает quantity со склада. Для товара без учёта остатка
+// ничего не делает, при нехватке возвращает ErrOutOfStock.
+func (r *DB) TakeMerchStock(ctx context.Context, name string, quantity int64, conn Querier) error {
+
+	q := "UPDATE merch SET stock = stock - $2 WHERE name = $1 AND stock IS NOT NULL AND stock >= $2"
+	tag, err := conn.Exec(ctx, q, name, quantity)
+	if err != nil {
+		return fmt.Errorf("failed to take merch stock: %w", err)
+	}
+	if tag.RowsAffected() == 1 {
+		return nil
+	}
+
+	// Строка не обновилась: либо остаток не ведётся, либо его не хватает.
+	q = "SELECT stock FROM merch WHERE name = $1"
+	row := conn.QueryRow(ctx, q, name)
+	var stock *int64
+	if err := row.Scan(&stock); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrItemNotFound
+		}
+		return fmt.Errorf("failed to query merch stock: %w", err)
+	}
+	if stock != nil {
+		return ErrOutOfStock
+	}
+	return nil
+}
+
+// AddMerchStock прибавляет delta к остатку и возвращает новый остаток.
+func (r *DB) AddMerchStock(ctx context.Context, name string, delta int64, conn Querier) (int64, error) {
+
+	q := "UPDATE merch SET stock = stock + $2 WHERE name = $1 RETURNING stock"
+	row := conn.QueryRow(ctx, q, name, delta)
+	var stock *int64
+	if err := row.Scan(&stock); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrItemNotFound
+		}
+		return 0, fmt.Errorf("failed to add merch stock: %w", err)
+	}
+	if stock == nil {
+		return 0, ErrUnlimitedStock
+	}
+	return *stock, nil
+}
+
+// SetMerchStock задаёт остаток; nil снимает ограничение.
+func (r *DB) SetMerchStock(ctx context.Context, name string, stock *int64, conn Querier) error {
+
+	q := "UPDATE merch SET stock = $2 WHERE name = $1"
+	tag, err := conn.Exec(ctx, q, name, stock)
+	if err != nil {
+		return fmt.Errorf("failed to set merch stock: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrItemNotFound
+	}
+	return nil
+}
+
+func (t *pgTx) GetMerchItemForUpdate(ctx context.Context, name string) (*MerchItem, error) {
+	return t.db.GetMerchItemForUpdate(ctx, name, t.tx)
+}
+
+func (t *pgTx) InsertMerchItem(ctx context.Context, item MerchItem) error {
+	return t.db.InsertMerchItem(ctx, item, t.tx)
+}
+
+func (t *pgTx) UpdateMerchItem(ctx context.Context, item MerchItem) error {
+	return t.db.UpdateMerchItem(ctx, item, t.tx)
+}
+
+func (t *pgTx) TakeMerchStock(ctx context.Context, name string, quantity int64) error {
+	return t.db.TakeMerchStock(ctx, name, quantity, t.tx)
+}
+
+func (t *pgTx) AddMerchStock(ctx context.Context, name string, delta int64) (int64, error) {
+	return t.db.AddMerchStock(ctx, name, delta, t.tx)
+}
+
+func (t *pgTx) SetMerchStock(ctx context.Context, name string, stock *int64) error {
+	return t.db.SetMerchStock(ctx, name, stock, t.tx)
+}
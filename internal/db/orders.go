@@ -0,0 +1,203 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrOrderNotFound возвращают изменения заказа, которого нет.
+var ErrOrderNotFound = errors.New("order not found")
+
+// Статусы заказа. Заказ оформляется в OrderPlaced, затем собирается
+// (OrderReady) и выдаётся (OrderHandedOver). OrderCancelled - отменённый заказ.
+const (
+	OrderPlaced     = "placed"
+	OrderReady      = "ready"
+	OrderHandedOver = "handed_over"
+	OrderCancelled  = "cancelled"
+)
+
+// ValidOrderStatus сообщает, известен ли статус заказа.
+func ValidOrderStatus(status string) bool {
+	switch status {
+	case OrderPlaced, OrderReady, OrderHandedOver, OrderCancelled:
+		return true
+	}
+	return false
+}
+
+// Order - заказ пользователя: одна или несколько строк покупок, оплаченных
+// одной транзакцией на сумму Total.
+type Order struct {
+	ID        int64
+	Username  string
+	Total     int64
+	Status    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Lines     []OrderLine
+}
+
+// OrderLine - строка заказа: товар и число штук. Price - цена штуки в
+// момент оплаты, при оформлении заказа её заполняет магазин.
+type OrderLine struct {
+	Item     string
+	Quantity int64
+	Price    int64
+}
+
+// OrderFilter - условия выборки заказов. Пустые поля не ограничивают выборку.
+type OrderFilter struct {
+	Username string
+	Status   string
+	Limit    int
+}
+
+const orderColumns = "id, username, total, status, created_at, updated_at"
+
+func scanOrder(row pgx.Row) (*Order, error) {
+	var o Order
+	if err := row.Scan(&o.ID, &o.Username, &o.Total, &o.Status, &o.CreatedAt, &o.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// InsertOrder создаёт заказ в статусе OrderPlaced и возвращает его
+// с присвоенными ID и временем создания. Строки пишутся через InsertPurchases.
+func (r *DB) InsertOrder(ctx context.Context, order Order, conn Querier) (*Order, error) {
+
+	q := "INSERT INTO orders (username, total) VALUES ($1, $2) RETURNING " + orderColumns
+	row := conn.QueryRow(ctx, q, order.Username, order.Total)
+	created, err := scanOrder(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to INSERT INTO orders: %w", err)
+	}
+	created.Lines = order.Lines
+	return created, nil
+}
+
+func (r *DB) GetOrder(ctx context.Context, id int64) (*Order, error) {
+	return r.getOrder(ctx, id, "", r.DBPool)
+}
+
+// GetOrderForUpdate читает заказ и блокирует его строку до конца транзакции.
+func (r *DB) GetOrderForUpdate(ctx context.Context, id int64, conn Querier) (*Order, error) {
+	return r.getOrder(ctx, id, " FOR UPDATE", conn)
+}
+
+func (r *DB) getOrder(ctx context.Context, id int64, lock string, conn Querier) (*Order, error) {
+
+	q := "SELECT " + orderColumns + " FROM orders WHERE id = $1" + lock
+	row := conn.QueryRow(ctx, q, id)
+	order, err := scanOrder(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query order: %w", err)
+	}
+
+	lines, err := r.orderLines(ctx, []int64{order.ID}, conn)
+	if err != nil {
+		return nil, err
+	}
+	order.Lines = lines[order.ID]
+	return order, nil
+}
+
+// ListOrders возвращает заказы со строками, новые первыми.
+func (r *DB) ListOrders(ctx context.Context, filter OrderFilter) ([]Order, error) {
+
+	q := "SELECT " + orderColumns + ` FROM orders
+		WHERE ($1 = '' OR username = $1)
+			AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT NULLIF($3, 0)`
+	rows, err := r.DBPool.Query(ctx, q, filter.Username, filter.Status, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []Order
+	var ids []int64
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, *order)
+		ids = append(ids, order.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, nil
+	}
+
+	lines, err := r.orderLines(ctx, ids, r.DBPool)
+	if err != nil {
+		return nil, err
+	}
+	for i := range orders {
+		orders[i].Lines = lines[orders[i].ID]
+	}
+	return orders, nil
+}
+
+func (r *DB) orderLines(ctx context.Context, ids []int64, conn Querier) (map[int64][]OrderLine, error) {
+
+	q := `
+		SELECT order_id, merch_item, quantity, price
+		FROM purchases
+		WHERE order_id = ANY($1)
+		ORDER BY order_id, merch_item
+	`
+	rows, err := conn.Query(ctx, q, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order lines: %w", err)
+	}
+	defer rows.Close()
+
+	lines := make(map[int64][]OrderLine, len(ids))
+	for rows.Next() {
+		var id int64
+		var line OrderLine
+		if err := rows.Scan(&id, &line.Item, &line.Quantity, &line.Price); err != nil {
+			return nil, fmt.Errorf("failed to scan order line: %w", err)
+		}
+		lines[id] = append(lines[id], line)
+	}
+	return lines, rows.Err()
+}
+
+func (r *DB) SetOrderStatus(ctx context.Context, id int64, status string, conn Querier) error {
+
+	q := "UPDATE orders SET status = $2, updated_at = now() WHERE id = $1"
+	tag, err := conn.Exec(ctx, q, id, status)
+	if err != nil {
+		return fmt.Errorf("failed to update order status: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrOrderNotFound
+	}
+	return nil
+}
+
+func (t *pgTx) InsertOrder(ctx context.Context, order Order) (*Order, error) {
+	return t.db.InsertOrder(ctx, order, t.tx)
+}
+
+func (t *pgTx) GetOrderForUpdate(ctx context.Context, id int64) (*Order, error) {
+	return t.db.GetOrderForUpdate(ctx, id, t.tx)
+}
+
+func (t *pgTx) SetOrderStatus(ctx context.Context, id int64, status string) error {
+	return t.db.SetOrderStatus(ctx, id, status, t.tx)
+}
@@ -7,7 +7,6 @@ import (
 	"log/slog"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -19,17 +18,33 @@ type User struct{
 	Username string
 	HashedPassword string
 	Balance     int64
+	Roles       []string
+	// Frozen - счёт заморожен после расхождения баланса с историей.
+	Frozen      bool
 }
 
 type Purchases struct {
 	Username string
     Merch_item string
+	// OrderID - заказ, в который входит покупка. 0 - покупка без заказа.
+	OrderID  int64
+	// Quantity - число штук, 0 считается одной.
+	Quantity int64
+	// Price - цена одной штуки в момент покупки, Currency - её валюта
+	// (пустая считается CurrencyCoin).
+	Price    int64
+	Currency string
 }
 
 type TransactionLog struct {
+    // ID заполняет InsertTransaction_log.
+    ID int64
     Sender string
     Recipient string
     Amount int64
+    // Message и Category - необязательная подпись отправителя к переводу.
+    Message string
+    Category string
 }
 
 func New(ctx context.Context, connectionString string) (*DB, error) {
@@ -43,13 +58,51 @@ func New(ctx context.Context, connectionString string) (*DB, error) {
 	return &DB{DBPool: pool}, nil
 }
 
+func (r *DB) Close() {
+	r.DBPool.Close()
+}
+
+// Begin открывает транзакцию в Postgres и оборачивает её в Tx.
+func (r *DB) Begin(ctx context.Context) (Tx, error) {
+	tx, err := r.DBPool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	return &pgTx{db: r, tx: tx}, nil
+}
+
+type pgTx struct {
+	db *DB
+	tx pgx.Tx
+}
+
+func (t *pgTx) InsertPurchases(ctx context.Context, purchase Purchases) error {
+	return t.db.InsertPurchases(ctx, purchase, t.tx)
+}
+
+func (t *pgTx) InsertTransaction_log(ctx context.Context, transaction TransactionLog) (*TransactionLog, error) {
+	return t.db.InsertTransaction_log(ctx, transaction, t.tx)
+}
+
+func (t *pgTx) Commit(ctx context.Context) error {
+	return t.tx.Commit(ctx)
+}
+
+func (t *pgTx) Rollback(ctx context.Context) error {
+	err := t.tx.Rollback(ctx)
+	if errors.Is(err, pgx.ErrTxClosed) {
+		return nil
+	}
+	return err
+}
+
 func (r *DB) GetUserByName(ctx context.Context, name string) (*User, error){
 	
-	q := "SELECT username, hashed_password, balance FROM users WHERE username = $1"
+	q := "SELECT username, hashed_password, balance, roles, frozen FROM users WHERE username = $1"
 	row := r.DBPool.QueryRow(ctx, q, name)
 
 	var user User
-	if err := row.Scan(&user.Username, &user.HashedPassword, &user.Balance); err != nil {
+	if err := row.Scan(&user.Username, &user.HashedPassword, &user.Balance, &user.Roles, &user.Frozen); err != nil {
 		if errors.Is(err, pgx.ErrNoRows){
 			return nil, nil
 		}
@@ -59,92 +112,72 @@ func (r *DB) GetUserByName(ctx context.Context, name string) (*User, error){
 	return &user, nil
 }
 
+// CreateUser добавляет пользователя. Если имя уже занято (в том числе
+// параллельным запросом), возвращает ErrUserExists.
 func (r *DB) CreateUser(ctx context.Context, user User) (*User, error) {
 
-
-	q := "INSERT INTO users (username, hashed_password, balance) VALUES ($1, $2, $3)"
-	_, err := r.DBPool.Exec(ctx, q, user.Username, string(user.HashedPassword), user.Balance)
-	if err != nil {
-		return nil, fmt.Errorf("failed to insert user: %w", err)
+	if user.Roles == nil {
+		user.Roles = []string{}
 	}
-	return &user, nil
-}
-
-func (r *DB) GetItemPrice(ctx context.Context, item string) (int64, error) {
-	
-	q := "SELECT price FROM merch WHERE name = $1"
-
-	row := r.DBPool.QueryRow(ctx, q, item)
-
-	var price int64 
-	if err := row.Scan(&price); err != nil {
-		if errors.Is(err, pgx.ErrNoRows){
-			return 0, fmt.Errorf("There is no such product: %w", err)
+	err := r.WithTx(ctx, func(q Querier) error {
+		// Баланс начисляется проводкой в openUserAccount.
+		tag, err := q.Exec(ctx,
+			"INSERT INTO users (username, hashed_password, balance, roles) VALUES ($1, $2, 0, $3) ON CONFLICT (username) DO NOTHING",
+			user.Username, string(user.HashedPassword), user.Roles)
+		if err != nil {
+			return fmt.Errorf("failed to insert user: %w", err)
 		}
-		
-		return 0, fmt.Errorf("failed to query item: %w", err)
+		if tag.RowsAffected() == 0 {
+			return ErrUserExists
+		}
+		return r.openUserAccount(ctx, user, q)
+	})
+	if err != nil {
+		return nil, err
 	}
-	return price, nil
+	return &user, nil
 }
 
 var ErrLowBalance = errors.New("No enough coins")
 
-func (r *DB) MinusUserBalance(ctx context.Context, username string, price int64, tx pgx.Tx) (error){
+// SetUserRoles заменяет роли пользователя. Если пользователя нет, возвращает ErrUserNotFound.
+func (r *DB) SetUserRoles(ctx context.Context, username string, roles []string) error {
 
-	q := "UPDATE users SET balance = balance - $1 WHERE username = $2"
-	var err error
-	if tx == nil{
-		_, err = r.DBPool.Exec(ctx, q, price, username )		
-	} else {
-		_, err = tx.Exec(ctx, q, price, username )
+	if roles == nil {
+		roles = []string{}
 	}
+	q := "UPDATE users SET roles = $2 WHERE username = $1"
+	tag, err := r.DBPool.Exec(ctx, q, username, roles)
 	if err != nil {
-		var pgErr *pgconn.PgError
-
-		if errors.As(err, &pgErr){
-			if pgErr.ConstraintName == "users_balance_non_negative"{
-				return ErrLowBalance
-			}
-		}
-		return fmt.Errorf("failed to update user balance: %w", err)
+		return fmt.Errorf("failed to update user roles: %w", err)
 	}
-	return  nil
-}
-
-func (r *DB) PlusUserBalance(ctx context.Context, username string, amount int64, tx pgx.Tx) (error){
-
-	q := "UPDATE users SET balance = balance + $1 WHERE username = $2"
-	var err error
-	if tx == nil{
-		_, err = r.DBPool.Exec(ctx, q, amount, username )		
-	} else {
-		_, err = tx.Exec(ctx, q, amount, username )
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
 	}
-	if err != nil {
-		return fmt.Errorf("failed to update recipient balance: %w", err)
-	}
-	return  nil
+	return nil
 }
 
-func (r *DB) InsertPurchases(ctx context.Context, purchase Purchases, tx pgx.Tx) (error){
+func (r *DB) InsertPurchases(ctx context.Context, purchase Purchases, conn Querier) (error){
 
-	q := "INSERT INTO purchases (username, merch_item) VALUES ($1, $2)"
-	var err error
-	if tx == nil{
-		_, err = r.DBPool.Exec(ctx, q, purchase.Username, purchase.Merch_item)		
-	} else {
-		_, err = tx.Exec(ctx, q, purchase.Username, purchase.Merch_item)
+	if purchase.Quantity == 0 {
+		purchase.Quantity = 1
+	}
+	if purchase.Currency == "" {
+		purchase.Currency = CurrencyCoin
 	}
+	q := "INSERT INTO purchases (username, merch_item, order_id, quantity, price, currency) VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6)"
+	args := []any{purchase.Username, purchase.Merch_item, purchase.OrderID, purchase.Quantity, purchase.Price, purchase.Currency}
+	_, err := conn.Exec(ctx, q, args...)
 	if err != nil {
 		return fmt.Errorf("failed to INSERT INTO purchases: %w", err)
 	}
 	return nil
 }
 
-func (r *DB) InsertTransaction_log(ctx context.Context, transaction TransactionLog, tx pgx.Tx) (*TransactionLog, error){
+func (r *DB) InsertTransaction_log(ctx context.Context, transaction TransactionLog, conn Querier) (*TransactionLog, error){
 
-	q := "INSERT INTO transaction_log (sender, recipient, amount) VALUES ($1, $2, $3)"
-	_, err := r.DBPool.Exec(ctx, q, transaction.Sender, transaction.Recipient, transaction.Amount)
+	q := "INSERT INTO transaction_log (sender, recipient, amount, message, category) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	err := conn.QueryRow(ctx, q, transaction.Sender, transaction.Recipient, transaction.Amount, transaction.Message, transaction.Category).Scan(&transaction.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to INSERT INTO transaction_log: %w", err)
 	}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Querier - общее подмножество пула и транзакции. Методы DB, которые
+// реализуют Tx, принимают Querier последним параметром и не открывают
+// своих транзакций: им передают транзакцию из WithTx, InTx или Begin.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+var (
+	_ Querier = (*pgxpool.Pool)(nil)
+	_ Querier = (pgx.Tx)(nil)
+)
+
+// WithTx выполняет fn в транзакции и фиксирует её, если fn вернула nil.
+// Все запросы через q идут в эту транзакцию. При serialization failure
+// и deadlock транзакция повторяется с паузой, поэтому fn не должна менять
+// ничего, кроме q.
+func (r *DB) WithTx(ctx context.Context, fn func(q Querier) error) error {
+	return retryTx(ctx, func() error {
+		return r.runTx(ctx, fn)
+	})
+}
+
+// InTx - WithTx, в котором fn работает через Tx.
+func (r *DB) InTx(ctx context.Context, fn func(tx Tx) error) error {
+	return r.WithTx(ctx, func(q Querier) error {
+		// runTx передаёт в fn саму транзакцию pgx.
+		return fn(&pgTx{db: r, tx: q.(pgx.Tx)})
+	})
+}
+
+// runTx - одна попытка WithTx.
+func (r *DB) runTx(ctx context.Context, fn func(q Querier) error) error {
+	tx, err := r.DBPool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestQuerierMethodsHaveSinglePath следит, чтобы методы DB, принимающие
+// Querier, не возвращали ветку "нет транзакции - идём в пул": вызывающий
+// сам передаёт DBPool или транзакцию.
+func TestQuerierMethodsHaveSinglePath(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := parser.ParseFile(fset, name, src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || fn.Body == nil || len(fn.Recv.List[0].Names) == 0 {
+				continue
+			}
+			recv := fn.Recv.List[0].Names[0].Name
+			conns := querierParams(fn)
+			if len(conns) == 0 {
+				continue
+			}
+
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.BinaryExpr:
+					if (n.Op == token.EQL || n.Op == token.NEQ) && (isNilCheck(n.X, n.Y, conns) || isNilCheck(n.Y, n.X, conns)) {
+						t.Errorf("%s: %s compares its Querier with nil", fset.Position(n.Pos()), fn.Name.Name)
+					}
+				case *ast.SelectorExpr:
+					if x, ok := n.X.(*ast.Ident); ok && x.Name == recv && n.Sel.Name == "DBPool" {
+						t.Errorf("%s: %s takes a Querier but uses DBPool", fset.Position(n.Pos()), fn.Name.Name)
+					}
+				}
+				return true
+			})
+		}
+	}
+}
+
+// querierParams возвращает имена параметров типа Querier и pgx.Tx.
+func querierParams(fn *ast.FuncDecl) map[string]bool {
+	names := make(map[string]bool)
+	for _, p := range fn.Type.Params.List {
+		switch typ := p.Type.(type) {
+		case *ast.Ident:
+			if typ.Name != "Querier" {
+				continue
+			}
+		case *ast.SelectorExpr:
+			if typ.Sel.Name != "Tx" {
+				continue
+			}
+		default:
+			continue
+		}
+		for _, n := range p.Names {
+			names[n.Name] = true
+		}
+	}
+	return names
+}
+
+func isNilCheck(x, y ast.Expr, conns map[string]bool) bool {
+	xi, ok := x.(*ast.Ident)
+	if !ok || !conns[xi.Name] {
+		return false
+	}
+	yi, ok := y.(*ast.Ident)
+	return ok && yi.Name == "nil"
+}
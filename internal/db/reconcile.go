@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrAccountFrozen возвращает PostJournalEntry при списании с замороженного счёта.
+var ErrAccountFrozen = errors.New("account is frozen")
+
+// BalanceHistory - баланс пользователя по кешу, по главной книге и суммы
+// операций, из которых его можно пересчитать.
+type BalanceHistory struct {
+	Username string
+	// Balance - кеш users.balance.
+	Balance int64
+	// Ledger - сумма строк проводок по счёту пользователя.
+	Ledger int64
+	// Opening - сумма приветственной или вводной проводки, с которой открыт
+	// счёт. Остальные суммы считаются только по операциям после открытия
+	// счёта: вводная проводка уже включает всё, что было до неё.
+	Opening  int64
+	Received int64
+	Sent     int64
+	// Spent - стоимость всех покупок, включая отменённые заказы, по цене
+	// в момент оплаты.
+	Spent    int64
+	Refunded int64
+	Frozen   bool
+}
+
+// ListBalanceHistory возвращает историю балансов всех пользователей по имени.
+func (r *DB) ListBalanceHistory(ctx context.Context) ([]BalanceHistory, error) {
+
+	q := `
+		SELECT u.username, u.balance, u.frozen,
+			COALESCE((SELECT SUM(amount) FROM postings WHERE account_id = a.id), 0)::BIGINT,
+			COALESCE((SELECT SUM(p.amount) FROM postings p JOIN journal_entries e ON e.id = p.entry_id
+				WHERE p.account_id = a.id AND e.kind IN ('welcome', 'opening')), 0)::BIGINT,
+			COALESCE((SELECT SUM(amount) FROM transaction_log
+				WHERE recipient = u.username AND created_at >= a.created_at), 0)::BIGINT,
+			COALESCE((SELECT SUM(amount) FROM transaction_log
+				WHERE sender = u.username AND created_at >= a.created_at), 0)::BIGINT,
+			COALESCE((SELECT SUM(quantity * price) FROM purchases
+				WHERE username = u.username AND created_at >= a.created_at), 0)::BIGINT,
+			COALESCE((SELECT SUM(amount) FROM refunds
+				WHERE username = u.username AND created_at >= a.created_at), 0)::BIGINT
+		FROM users u
+		JOIN ledger_accounts a ON a.id = 'user:' || u.username
+		ORDER BY u.username
+	`
+	rows, err := r.DBPool.Query(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query balance history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []BalanceHistory
+	for rows.Next() {
+		var h BalanceHistory
+		if err := rows.Scan(&h.Username, &h.Balance, &h.Frozen, &h.Ledger, &h.Opening, &h.Received, &h.Sent, &h.Spent, &h.Refunded); err != nil {
+			return nil, fmt.Errorf("failed to scan balance history: %w", err)
+		}
+		history = append(history, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read balance history: %w", err)
+	}
+	return history, nil
+}
+
+// SetUserFrozen замораживает или размораживает счёт пользователя.
+func (r *DB) SetUserFrozen(ctx context.Context, username string, frozen bool, conn Querier) error {
+
+	q := "UPDATE users SET frozen = $1 WHERE username = $2"
+	tag, err := conn.Exec(ctx, q, frozen, username)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (t *pgTx) SetUserFrozen(ctx context.Context, username string, frozen bool) error {
+	return t.db.SetUserFrozen(ctx, username, frozen, t.tx)
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type RefreshToken struct {
+	TokenHash  string
+	Username   string
+	FamilyID   string
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	RevokedAt  *time.Time
+	ReplacedBy string
+}
+
+func (r *DB) GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+
+	q := `
+		SELECT token_hash, username, family_id, expires_at, created_at, revoked_at, COALESCE(replaced_by, '')
+		FROM refresh_tokens
+		WHERE token_hash = $1
+	`
+	row := r.DBPool.QueryRow(ctx, q, tokenHash)
+
+	var rt RefreshToken
+	err := row.Scan(&rt.TokenHash, &rt.Username, &rt.FamilyID, &rt.ExpiresAt, &rt.CreatedAt, &rt.RevokedAt, &rt.ReplacedBy)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query refresh token: %w", err)
+	}
+	return &rt, nil
+}
+
+func (r *DB) InsertRefreshToken(ctx context.Context, token RefreshToken, conn Querier) error {
+
+	q := "INSERT INTO refresh_tokens (token_hash, username, family_id, expires_at) VALUES ($1, $2, $3, $4)"
+	_, err := conn.Exec(ctx, q, token.TokenHash, token.Username, token.FamilyID, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to INSERT INTO refresh_tokens: %w", err)
+	}
+	return nil
+}
+
+// RevokeRefreshToken помечает токен отозванным и заменённым на replacedBy.
+// Возвращает false, если токен уже был отозван раньше.
+func (r *DB) RevokeRefreshToken(ctx context.Context, tokenHash, replacedBy string, conn Querier) (bool, error) {
+
+	q := `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, replaced_by = NULLIF($2, '')
+		WHERE token_hash = $1 AND revoked_at IS NULL
+	`
+	tag, err := conn.Exec(ctx, q, tokenHash, replacedBy)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *DB) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+
+	q := "UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND revoked_at IS NULL"
+	_, err := r.DBPool.Exec(ctx, q, familyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+	return nil
+}
+
+func (t *pgTx) InsertRefreshToken(ctx context.Context, token RefreshToken) error {
+	return t.db.InsertRefreshToken(ctx, token, t.tx)
+}
+
+func (t *pgTx) RevokeRefreshToken(ctx context.Context, tokenHash, replacedBy string) (bool, error) {
+	return t.db.RevokeRefreshToken(ctx, tokenHash, replacedBy, t.tx)
+}
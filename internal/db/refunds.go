@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrAlreadyRefunded возвращает InsertRefund, если за заказ уже вернули монеты.
+var ErrAlreadyRefunded = errors.New("order has already been refunded")
+
+// Refund - возврат монет пользователю за отменённый заказ.
+type Refund struct {
+	ID        int64
+	OrderID   int64
+	Username  string
+	Amount    int64
+	CreatedAt time.Time
+}
+
+func (r *DB) InsertRefund(ctx context.Context, refund Refund, conn Querier) error {
+
+	q := `
+		INSERT INTO refunds (order_id, username, amount) VALUES ($1, $2, $3)
+		ON CONFLICT (order_id) DO NOTHING
+	`
+	tag, err := conn.Exec(ctx, q, refund.OrderID, refund.Username, refund.Amount)
+	if err != nil {
+		return fmt.Errorf("failed to INSERT INTO refunds: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAlreadyRefunded
+	}
+	return nil
+}
+
+// GetUserRefunds возвращает возвраты пользователя, новые первыми.
+func (r *DB) GetUserRefunds(ctx context.Context, username string) ([]Refund, error) {
+
+	q := `
+		SELECT id, order_id, username, amount, created_at
+		FROM refunds
+		WHERE username = $1
+		ORDER BY id DESC
+	`
+	rows, err := r.DBPool.Query(ctx, q, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query refunds: %w", err)
+	}
+	defer rows.Close()
+
+	var refunds []Refund
+	for rows.Next() {
+		var rf Refund
+		if err := rows.Scan(&rf.ID, &rf.OrderID, &rf.Username, &rf.Amount, &rf.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan refund: %w", err)
+		}
+		refunds = append(refunds, rf)
+	}
+	return refunds, rows.Err()
+}
+
+func (t *pgTx) InsertRefund(ctx context.Context, refund Refund) error {
+	return t.db.InsertRefund(ctx, refund, t.tx)
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SQLSTATE ошибок, после которых Postgres откатывает транзакцию и её
+// можно просто повторить.
+const (
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+// Повторы InTx: до txMaxAttempts попыток, пауза удваивается от
+// txRetryBaseDelay и получает случайную добавку, чтобы встречные
+// транзакции не столкнулись снова.
+const (
+	txMaxAttempts    = 5
+	txRetryBaseDelay = 10 * time.Millisecond
+)
+
+// Retryable сообщает, что транзакция откатилась из-за serialization failure
+// или deadlock и её можно выполнить заново.
+func Retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == sqlStateSerializationFailure || pgErr.Code == sqlStateDeadlockDetected
+}
+
+// retryDelay - пауза перед попыткой attempt+1.
+func retryDelay(attempt int) time.Duration {
+	delay := txRetryBaseDelay << (attempt - 1)
+	return delay + rand.N(delay)
+}
+
+// retryTx вызывает run, пока тот возвращает Retryable ошибку, но не больше
+// txMaxAttempts раз, с паузой retryDelay между попытками.
+func retryTx(ctx context.Context, run func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := run()
+		if err == nil || !Retryable(err) || attempt == txMaxAttempts {
+			return err
+		}
+
+		delay := retryDelay(attempt)
+		slog.Warn("Retrying transaction", slog.Int("attempt", attempt), slog.Duration("delay", delay), slog.String("error", err.Error()))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "serialization failure", err: &pgconn.PgError{Code: "40001"}, want: true},
+		{name: "deadlock", err: fmt.Errorf("failed to lock users: %w", &pgconn.PgError{Code: "40P01"}), want: true},
+		{name: "check violation", err: &pgconn.PgError{Code: "23514"}},
+		{name: "not a postgres error", err: errors.New("boom")},
+		{name: "nil", err: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(tt.err); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt := 1; attempt < txMaxAttempts; attempt++ {
+		base := txRetryBaseDelay << (attempt - 1)
+		for range 20 {
+			if d := retryDelay(attempt); d < base || d >= 2*base {
+				t.Fatalf("attempt %d: expected delay in [%v, %v), got %v", attempt, base, 2*base, d)
+			}
+		}
+	}
+}
+
+func TestRetryTx(t *testing.T) {
+	deadlock := &pgconn.PgError{Code: "40P01"}
+
+	tests := []struct {
+		name         string
+		failures     int
+		err          error
+		wantAttempts int
+		wantErr      error
+	}{
+		{name: "first attempt succeeds", wantAttempts: 1},
+		{name: "succeeds after deadlocks", failures: 2, err: deadlock, wantAttempts: 3},
+		{name: "gives up after max attempts", failures: txMaxAttempts + 1, err: deadlock, wantAttempts: txMaxAttempts, wantErr: deadlock},
+		{name: "other errors are not retried", failures: 1, err: ErrLowBalance, wantAttempts: 1, wantErr: ErrLowBalance},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int
+			err := retryTx(context.Background(), func() error {
+				attempts++
+				if attempts <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("expected %d attempts, got %d", tt.wantAttempts, attempts)
+			}
+		})
+	}
+}
+
+func TestRetryTxStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var attempts int
+	err := retryTx(ctx, func() error {
+		attempts++
+		cancel()
+		return &pgconn.PgError{Code: "40001"}
+	})
+	if !errors.Is(err, context.Canceled) || attempts != 1 {
+		t.Errorf("expected context.Canceled after 1 attempt, got %v after %d", err, attempts)
+	}
+}
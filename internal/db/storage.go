@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrItemNotFound возвращается, когда в каталоге нет запрошенного товара.
+var ErrItemNotFound = errors.New("there is no such product")
+
+// ErrUserExists возвращает CreateUser, если имя уже занято.
+var ErrUserExists = errors.New("user already exists")
+
+// ErrUserNotFound возвращают изменения пользователя, которого нет.
+var ErrUserNotFound = errors.New("user not found")
+
+// Storage описывает хранилище магазина, с которым работают обработчики.
+// Его реализуют DB (Postgres) и memory.Store (в памяти, для тестов и локального запуска).
+type Storage interface {
+	GetUserByName(ctx context.Context, name string) (*User, error)
+	// CreateUser заводит пользователя и его счёт в главной книге. user.Balance -
+	// приветственные монеты, они зачисляются проводкой со счёта AccountIssuance.
+	CreateUser(ctx context.Context, user User) (*User, error)
+	SetUserRoles(ctx context.Context, username string, roles []string) error
+	// GetMerchItem возвращает nil, nil, если товара нет.
+	GetMerchItem(ctx context.Context, name string) (*MerchItem, error)
+	ListMerchItems(ctx context.Context, filter MerchFilter) ([]MerchItem, error)
+	// GetOrder возвращает заказ со строками или nil, nil, если заказа нет.
+	GetOrder(ctx context.Context, id int64) (*Order, error)
+	ListOrders(ctx context.Context, filter OrderFilter) ([]Order, error)
+	GetUserPurchases(ctx context.Context, username string) ([]PurchaseCount, error)
+	GetTransactionsReceived(ctx context.Context, username string) ([]ReceivedTransaction, error)
+	GetTransactionsSent(ctx context.Context, username string) ([]SentTransaction, error)
+	// SetTransferReaction возвращает ErrTransferNotFound, если перевода нет
+	// или recipient не его получатель.
+	SetTransferReaction(ctx context.Context, id int64, recipient, reaction string) error
+	GetUserRefunds(ctx context.Context, username string) ([]Refund, error)
+	// GetLedgerBalance возвращает баланс счёта по главной книге.
+	GetLedgerBalance(ctx context.Context, account string) (int64, error)
+	// ListBalanceHistory возвращает для каждого пользователя баланс по кешу,
+	// по книге и суммы операций, из которых он складывается.
+	ListBalanceHistory(ctx context.Context) ([]BalanceHistory, error)
+	// ListAuditEntries возвращает последние limit записей журнала по target.
+	ListAuditEntries(ctx context.Context, target string, limit int) ([]AuditEntry, error)
+
+	// GetRefreshToken возвращает nil, nil, если токена с таким хешем нет.
+	GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+
+	// GetLoginFailure возвращает nil, nil, если неудачных входов по ключу нет.
+	GetLoginFailure(ctx context.Context, key string) (*LoginFailure, error)
+	AddLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	ResetLoginFailures(ctx context.Context, key string) error
+	DeleteStaleLoginFailures(ctx context.Context, now time.Time, window time.Duration) (int64, error)
+
+	ReserveIdempotencyKey(ctx context.Context, rec IdempotencyRecord, now time.Time) (*IdempotencyRecord, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, rec IdempotencyRecord) error
+	ReleaseIdempotencyKey(ctx context.Context, username, key string) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+
+	// TryLock берёт блокировку name, общую для всех экземпляров сервиса.
+	// Если её уже держат, возвращает ok == false.
+	TryLock(ctx context.Context, name string) (unlock func(), ok bool, err error)
+	// ClaimJobRun возвращает false, если запуск job за slot уже отмечен.
+	ClaimJobRun(ctx context.Context, job string, slot time.Time) (bool, error)
+
+	// Begin открывает единицу работы. Изменения, сделанные через Tx,
+	// становятся видны только после Commit.
+	Begin(ctx context.Context) (Tx, error)
+	// InTx выполняет fn в единице работы и фиксирует её, если fn вернула nil.
+	// Транзакция, откатившаяся из-за serialization failure или deadlock,
+	// выполняется заново, поэтому fn должна менять состояние только через tx.
+	InTx(ctx context.Context, fn func(tx Tx) error) error
+
+	Close()
+}
+
+var _ Storage = (*DB)(nil)
+
+// Tx - единица работы над балансами, покупками, заказами, переводами,
+// refresh-токенами и каталогом.
+// Rollback после Commit безопасен, поэтому его можно звать в defer.
+type Tx interface {
+	// PostJournalEntry записывает проводку и обновляет балансы пользователей.
+	// Если баланс пользователя ушёл бы в минус - ErrLowBalance, если списание
+	// идёт с замороженного счёта - ErrAccountFrozen.
+	PostJournalEntry(ctx context.Context, entry JournalEntry) (*JournalEntry, error)
+	// SetUserFrozen возвращает ErrUserNotFound, если пользователя нет.
+	SetUserFrozen(ctx context.Context, username string, frozen bool) error
+	InsertOrder(ctx context.Context, order Order) (*Order, error)
+	// GetOrderForUpdate возвращает nil, nil, если заказа нет.
+	GetOrderForUpdate(ctx context.Context, id int64) (*Order, error)
+	SetOrderStatus(ctx context.Context, id int64, status string) error
+	// InsertRefund возвращает ErrAlreadyRefunded, если за заказ уже вернули монеты.
+	InsertRefund(ctx context.Context, refund Refund) error
+	InsertPurchases(ctx context.Context, purchase Purchases) error
+	InsertTransaction_log(ctx context.Context, transaction TransactionLog) (*TransactionLog, error)
+	InsertRefreshToken(ctx context.Context, token RefreshToken) error
+	RevokeRefreshToken(ctx context.Context, tokenHash, replacedBy string) (bool, error)
+	// GetMerchItemForUpdate возвращает nil, nil, если товара нет.
+	GetMerchItemForUpdate(ctx context.Context, name string) (*MerchItem, error)
+	InsertMerchItem(ctx context.Context, item MerchItem) error
+	UpdateMerchItem(ctx context.Context, item MerchItem) error
+	// TakeMerchStock списывает товар со склада или возвращает ErrOutOfStock.
+	TakeMerchStock(ctx context.Context, name string, quantity int64) error
+	// AddMerchStock возвращает ErrUnlimitedStock для товара без учёта остатка.
+	AddMerchStock(ctx context.Context, name string, delta int64) (int64, error)
+	SetMerchStock(ctx context.Context, name string, stock *int64) error
+	InsertAuditEntry(ctx context.Context, entry AuditEntry) error
+
+	Commit(ctx context.Context) error
+	Rollback(ctx context.Context) error
+}
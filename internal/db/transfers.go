@@ -0,0 +1,30 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrTransferNotFound возвращает SetTransferReaction, если у получателя нет
+// перевода с таким id.
+var ErrTransferNotFound = errors.New("transfer not found")
+
+// SetTransferReaction ставит реакцию получателя на перевод. Пустая реакция
+// снимает прежнюю.
+func (r *DB) SetTransferReaction(ctx context.Context, id int64, recipient, reaction string) error {
+
+	q := `
+		UPDATE transaction_log
+		SET reaction = $3, reacted_at = CASE WHEN $3 = '' THEN NULL ELSE now() END
+		WHERE id = $1 AND recipient = $2
+	`
+	tag, err := r.DBPool.Exec(ctx, q, id, recipient, reaction)
+	if err != nil {
+		return fmt.Errorf("failed to update transfer reaction: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTransferNotFound
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/titoffon/merch-store/internal/service"
+)
+
+type RolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+// UnlockUser снимает блокировку входа пользователя.
+func (h *Handlers) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+
+	if err := h.AuthService.Unlock(r.Context(), username); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidUsername):
+			ResponseError(w, http.StatusBadRequest, "Invalid username")
+		case errors.Is(err, service.ErrUserNotFound):
+			ResponseError(w, http.StatusNotFound, "User not found")
+		default:
+			slog.Error("Failed to unlock user", slog.String("error", err.Error()))
+			ResponseError(w, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+}
+
+// SetUserRoles заменяет роли пользователя.
+func (h *Handlers) SetUserRoles(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+
+	var req RolesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ResponseError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	err := h.AuthService.SetRoles(r.Context(), username, req.Roles)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnknownRole):
+			ResponseError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrUserNotFound):
+			ResponseError(w, http.StatusNotFound, "User not found")
+		default:
+			slog.Error("Failed to set user roles", slog.String("error", err.Error()))
+			ResponseError(w, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/titoffon/merch-store/internal/db"
+	"github.com/titoffon/merch-store/internal/service"
+)
+
+// auditHistoryLimit - сколько последних записей аудита отдаёт история товара.
+const auditHistoryLimit = 100
+
+type MerchItemResponse struct {
+	Name        string `json:"name"`
+	Price       int64  `json:"price"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	ImageURL    string `json:"imageUrl"`
+	Active      bool   `json:"active"`
+	// Stock - остаток на складе; null - товар не ограничен.
+	Stock *int64 `json:"stock"`
+}
+
+type CreateMerchItemRequest struct {
+	Name        string `json:"name"`
+	Price       int64  `json:"price"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	ImageURL    string `json:"imageUrl"`
+	// Active по умолчанию true.
+	Active *bool `json:"active"`
+	// Stock - начальный остаток; без него товар не ограничен.
+	Stock *int64 `json:"stock"`
+}
+
+type UpdateMerchItemRequest struct {
+	Price       *int64  `json:"price"`
+	Description *string `json:"description"`
+	Category    *string `json:"category"`
+	ImageURL    *string `json:"imageUrl"`
+	Active      *bool   `json:"active"`
+}
+
+type RestockRequest struct {
+	Quantity int64 `json:"quantity"`
+}
+
+type SetStockRequest struct {
+	Stock *int64 `json:"stock"`
+}
+
+type AuditEntryResponse struct {
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Details   json.RawMessage `json:"details"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+func toMerchItemResponse(item db.MerchItem) MerchItemResponse {
+	return MerchItemResponse{
+		Name:        item.Name,
+		Price:       item.Price,
+		Description: item.Description,
+		Category:    item.Category,
+		ImageURL:    item.ImageURL,
+		Active:      item.Active,
+		Stock:       item.Stock,
+	}
+}
+
+// ListMerchAdmin отдаёт весь каталог, включая снятые с продажи товары.
+func (h *Handlers) ListMerchAdmin(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Catalog.List(r.Context(), db.MerchFilter{IncludeArchived: true})
+	if err != nil {
+		slog.Error("Failed to list merch", slog.String("error", err.Error()))
+		ResponseError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	resp := make([]MerchItemResponse, 0, len(items))
+	for _, item := range items {
+		resp = append(resp, toMerchItemResponse(item))
+	}
+	ResponseJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handlers) CreateMerchItem(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateMerchItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ResponseError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+
+	item, err := h.Catalog.Create(r.Context(), principal.Username, db.MerchItem{
+		Name:        req.Name,
+		Price:       req.Price,
+		Description: req.Description,
+		Category:    req.Category,
+		ImageURL:    req.ImageURL,
+		Active:      active,
+		Stock:       req.Stock,
+	})
+	if err != nil {
+		respondCatalogError(w, err)
+		return
+	}
+	ResponseJSON(w, http.StatusCreated, toMerchItemResponse(*item))
+}
+
+func (h *Handlers) UpdateMerchItem(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateMerchItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ResponseError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	item, err := h.Catalog.Update(r.Context(), principal.Username, chi.URLParam(r, "item"), service.ItemPatch{
+		Price:       req.Price,
+		Description: req.Description,
+		Category:    req.Category,
+		ImageURL:    req.ImageURL,
+		Active:      req.Active,
+	})
+	if err != nil {
+		respondCatalogError(w, err)
+		return
+	}
+	ResponseJSON(w, http.StatusOK, toMerchItemResponse(*item))
+}
+
+// ArchiveMerchItem снимает товар с продажи. Физически товар не удаляется.
+func (h *Handlers) ArchiveMerchItem(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	item, err := h.Catalog.Archive(r.Context(), principal.Username, chi.URLParam(r, "item"))
+	if err != nil {
+		respondCatalogError(w, err)
+		return
+	}
+	ResponseJSON(w, http.StatusOK, toMerchItemResponse(*item))
+}
+
+// RestockMerchItem добавляет товар на склад.
+func (h *Handlers) RestockMerchItem(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var req RestockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ResponseError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	item, err := h.Catalog.Restock(r.Context(), principal.Username, chi.URLParam(r, "item"), req.Quantity)
+	if err != nil {
+		respondCatalogError(w, err)
+		return
+	}
+	ResponseJSON(w, http.StatusOK, toMerchItemResponse(*item))
+}
+
+// SetMerchStock задаёт остаток по итогам инвентаризации. {"stock": null}
+// снимает ограничение.
+func (h *Handlers) SetMerchStock(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var req SetStockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ResponseError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	item, err := h.Catalog.SetStock(r.Context(), principal.Username, chi.URLParam(r, "item"), req.Stock)
+	if err != nil {
+		respondCatalogError(w, err)
+		return
+	}
+	ResponseJSON(w, http.StatusOK, toMerchItemResponse(*item))
+}
+
+// MerchItemHistory отдаёт журнал изменений товара, новые записи первыми.
+func (h *Handlers) MerchItemHistory(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.Catalog.History(r.Context(), chi.URLParam(r, "item"), auditHistoryLimit)
+	if err != nil {
+		slog.Error("Failed to get merch history", slog.String("error", err.Error()))
+		ResponseError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	resp := make([]AuditEntryResponse, 0, len(entries))
+	for _, e := range entries {
+		resp = append(resp, AuditEntryResponse{
+			Actor:     e.Actor,
+			Action:    e.Action,
+			Details:   e.Details,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	ResponseJSON(w, http.StatusOK, resp)
+}
+
+func respondCatalogError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidItem):
+		ResponseError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrItemExists):
+		ResponseError(w, http.StatusConflict, "Item already exists")
+	case errors.Is(err, service.ErrUnlimitedStock):
+		ResponseError(w, http.StatusConflict, "Item has unlimited stock")
+	case errors.Is(err, service.ErrItemNotFound):
+		ResponseError(w, http.StatusNotFound, "Item not found")
+	default:
+		slog.Error("Catalog operation failed", slog.String("error", err.Error()))
+		ResponseError(w, http.StatusInternalServerError, "internal error")
+	}
+}
@@ -2,164 +2,217 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
-	"os"
+	"strconv"
 
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/titoffon/merch-store/internal/db"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/titoffon/merch-store/internal/service"
+	"github.com/titoffon/merch-store/internal/token"
 )
 
-const WelcomCoins = 1000
-
 type AuthRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
 
 type AuthResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
 }
 
-type ErrorResponse struct{
+type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
 type Handlers struct {
-	Dal *db.DB
+	Shop        *service.Shop
+	Wallet      *service.Wallet
+	Account     *service.Account
+	Catalog     *service.Catalog
+	AuthService *service.Auth
+	Idempotency *service.Idempotency
+	Tokens      *token.Manager
 }
 
 func (h *Handlers) Auth(w http.ResponseWriter, r *http.Request) {
-		var req AuthRequest
-		err := json.NewDecoder(r.Body).Decode(&req)
-        if err != nil {
-			ResponseError(w, http.StatusBadRequest, "Invalid request body")
-			slog.Warn("Username and password must not be empty.")
-            return
-        }
-
-		if req.Username == "" || req.Password == "" {
-			slog.Warn("Validation failed")
-			ResponseError(w, 400, "Validation failed")
-			return
+	var req AuthRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ResponseError(w, http.StatusBadRequest, "Invalid request body")
+		slog.Warn("Username and password must not be empty.")
+		return
+	}
 
+	user, err := h.AuthService.Login(r.Context(), req.Username, req.Password, clientIP(r))
+	if err != nil {
+		var locked *service.LockedError
+		switch {
+		case errors.As(err, &locked):
+			slog.Warn("Login is locked", slog.String("username", req.Username))
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+			ResponseError(w, http.StatusTooManyRequests, "Too many failed login attempts")
+		case errors.Is(err, service.ErrEmptyCredentials):
+			slog.Warn("Validation failed")
+			ResponseError(w, http.StatusBadRequest, "Validation failed")
+		case errors.Is(err, service.ErrInvalidCredentials):
+			slog.Warn("Invalid username or password")
+			ResponseError(w, http.StatusUnauthorized, "Invalid username or password")
+		default:
+			slog.Error("Failed to login", slog.String("error", err.Error()))
+			ResponseError(w, http.StatusInternalServerError, "internal error")
 		}
-		
-		user, err := h.Dal.GetUserByName(r.Context(), req.Username)
-		if err != nil {
-			ResponseError(w, 500, "internal error")
-			slog.Error("Database error", slog.String("error", err.Error()))
-			return
-		}
+		return
+	}
 
-		if user == nil {
-			hashPassword, err := HashedPass( req.Password )
-			if err != nil{
-				ResponseError(w, 400, err.Error())
-				slog.Error("Failed to hash pass")
-				return
-			}
-			
-			user, err = h.Dal.CreateUser(r.Context(), db.User{
-				Username: req.Username,
-				HashedPassword: string(hashPassword),
-				Balance: WelcomCoins,
-			})
-			if err != nil {
-				ResponseError(w, 500, "internal error")
-				slog.Error("Failed to create user", slog.String("error", err.Error()))
-				return
-			}
-			
-
-			token, err := generateJWTToken(user.Username, []byte(os.Getenv("JWT_SECRET")))
-			if err != nil {
-				ResponseError(w, 500, "internal error")
-				slog.Error("Failed to generate token", slog.String("error", err.Error()))
-				return
-			}
-			
-			ResponseJWT(w, token)
-			return 
+	h.respondTokens(w, r, user.Username, user.Roles)
+}
 
-		}
+// Register создаёт пользователя и сразу выдаёт ему пару токенов.
+func (h *Handlers) Register(w http.ResponseWriter, r *http.Request) {
+	var req AuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ResponseError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
 
-		valid, err := CheckPassword(user.HashedPassword, req.Password)
-		if err != nil || !valid {
-			ResponseError(w, http.StatusUnauthorized, "Invalid password")
-			slog.Warn("Invalid password")
-			return
+	user, err := h.AuthService.Register(r.Context(), req.Username, req.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrEmptyCredentials):
+			ResponseError(w, http.StatusBadRequest, "Validation failed")
+		case errors.Is(err, service.ErrInvalidUsername), errors.Is(err, service.ErrWeakPassword):
+			ResponseError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrUserExists):
+			ResponseError(w, http.StatusConflict, "User already exists")
+		default:
+			slog.Error("Failed to register", slog.String("error", err.Error()))
+			ResponseError(w, http.StatusInternalServerError, "internal error")
 		}
-
-		token, err := generateJWTToken(user.Username, []byte(os.Getenv("JWT_SECRET")))
-		if err != nil {
-			ResponseError(w, 500, "internal error")
-			slog.Error("Failed to generate token", slog.String("error", err.Error()))
-			return
-		}		
-		ResponseJWT(w, token)
-		
+		return
 	}
 
+	slog.Info("User registered", slog.String("username", user.Username))
+	h.respondTokens(w, r, user.Username, user.Roles)
+}
 
+// RefreshToken обменивает refresh-токен на новую пару access/refresh.
+func (h *Handlers) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ResponseError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
 
-func CheckPassword(hashPassword, password string) (bool, error) {
+	user, refreshToken, err := h.AuthService.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			ResponseError(w, http.StatusUnauthorized, "Invalid refresh token")
+			return
+		}
+		slog.Error("Failed to refresh token", slog.String("error", err.Error()))
+		ResponseError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
 
-	err := bcrypt.CompareHashAndPassword([]byte(hashPassword), []byte(password))
+	accessToken, err := h.Tokens.Issue(user.Username, user.Roles...)
 	if err != nil {
-		slog.Info("The password is uncorrect")
-		return false, nil
+		ResponseError(w, http.StatusInternalServerError, "internal error")
+		slog.Error("Failed to generate token", slog.String("error", err.Error()))
+		return
 	}
-	slog.Info("The password is correct")
-	return true, nil
+	ResponseTokens(w, AuthResponse{Token: accessToken, RefreshToken: refreshToken})
 }
 
-func ResponseError(w http.ResponseWriter, code int, message string){
-			res, err := json.Marshal(ErrorResponse{
-				Error: message,
-			})
-			if err != nil{
-				slog.Error("failed Unmarshall")
-				http.Error(w, "Internal error", http.StatusInternalServerError  )
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(code)
-			w.Write(res)
-}
+// RevokeToken отзывает refresh-токен вместе со всей его цепочкой ротаций.
+func (h *Handlers) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ResponseError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
 
+	err := h.AuthService.RevokeRefreshToken(r.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			ResponseError(w, http.StatusBadRequest, "Refresh token is required")
+			return
+		}
+		slog.Error("Failed to revoke token", slog.String("error", err.Error()))
+		ResponseError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
 
-func ResponseJWT(w http.ResponseWriter, token string){
-			res, err := json.Marshal(AuthResponse{
-				Token: token,
-			})
-			if err != nil{
-				slog.Error("failed Unmarshall")
-				http.Error(w, "Internal error", http.StatusInternalServerError  )
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(200)
-			w.Write(res)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
 }
 
-	func HashedPass(password string) ([]byte, error){
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-			if err != nil {
-				return nil, fmt.Errorf("failed to hash password: %w", err)
-			}
-		return hashedPassword, nil
+func (h *Handlers) respondTokens(w http.ResponseWriter, r *http.Request, username string, roles []string) {
+	accessToken, err := h.Tokens.Issue(username, roles...)
+	if err != nil {
+		ResponseError(w, http.StatusInternalServerError, "internal error")
+		slog.Error("Failed to generate token", slog.String("error", err.Error()))
+		return
 	}
 
+	refreshToken, err := h.AuthService.IssueRefreshToken(r.Context(), username)
+	if err != nil {
+		ResponseError(w, http.StatusInternalServerError, "internal error")
+		slog.Error("Failed to issue refresh token", slog.String("error", err.Error()))
+		return
+	}
+	ResponseTokens(w, AuthResponse{Token: accessToken, RefreshToken: refreshToken})
+}
 
-func generateJWTToken(username string, secretKey []byte) (string, error) {
+// clientIP - адрес клиента без порта. Заголовки прокси не учитываются,
+// чтобы клиент не мог подменить адрес и обойти счётчик неудачных входов.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
 
-	claims := jwt.MapClaims{
-		"sub": username,
-		//"exp":      time.Now().Add(time.Hour * 72).Unix(),
+func ResponseError(w http.ResponseWriter, code int, message string) {
+	res, err := json.Marshal(ErrorResponse{
+		Error: message,
+	})
+	if err != nil {
+		slog.Error("failed Unmarshall")
+		http.Error(w, "Internal error", http.StatusInternalServerError)
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(res)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(secretKey)
+// ResponseJSON пишет v в теле ответа с кодом code.
+func ResponseJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode response", slog.String("error", err.Error()))
+	}
 }
 
+func ResponseJWT(w http.ResponseWriter, token string) {
+	ResponseTokens(w, AuthResponse{Token: token})
+}
+
+func ResponseTokens(w http.ResponseWriter, tokens AuthResponse) {
+	res, err := json.Marshal(tokens)
+	if err != nil {
+		slog.Error("failed Unmarshall")
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(res)
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/titoffon/merch-store/internal/service"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotentRequestBytes = 1 << 20
+)
+
+// Idempotent выполняет запрос с заголовком Idempotency-Key не больше одного
+// раза: повтор с тем же ключом и тем же запросом получает сохранённый ответ.
+// Ставится после Authenticate; ключи у каждого пользователя свои. Запросы
+// без заголовка проходят как обычно.
+func (h *Handlers) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentRequestBytes+1))
+		if err != nil {
+			ResponseError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if len(body) > maxIdempotentRequestBytes {
+			ResponseError(w, http.StatusRequestEntityTooLarge, "Request body is too large")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := r.Context()
+		replay, err := h.Idempotency.Begin(ctx, principal.Username, key, requestFingerprint(r, body))
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrInvalidIdempotencyKey):
+				ResponseError(w, http.StatusBadRequest, "Invalid Idempotency-Key")
+			case errors.Is(err, service.ErrIdempotencyKeyReused):
+				ResponseError(w, http.StatusUnprocessableEntity, "Idempotency-Key was used for a different request")
+			case errors.Is(err, service.ErrIdempotencyInProgress):
+				ResponseError(w, http.StatusConflict, "Request with this Idempotency-Key is in progress")
+			default:
+				slog.Error("Failed to check idempotency key", slog.String("error", err.Error()))
+				ResponseError(w, http.StatusInternalServerError, "internal error")
+			}
+			return
+		}
+		if replay != nil {
+			if replay.ContentType != "" {
+				w.Header().Set("Content-Type", replay.ContentType)
+			}
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			w.WriteHeader(replay.StatusCode)
+			w.Write(replay.Response)
+			return
+		}
+
+		// Ответ сохраняется, даже если клиент уже отключился: его повтор
+		// должен получить этот результат.
+		ctx = context.WithoutCancel(ctx)
+		// Если обработчик запаниковал, ключ освобождается, иначе повторы
+		// получали бы 409 до истечения ключа.
+		defer func() {
+			if p := recover(); p != nil {
+				if err := h.Idempotency.Release(ctx, principal.Username, key); err != nil {
+					slog.Error("Failed to release idempotency key",
+						slog.String("username", principal.Username),
+						slog.String("error", err.Error()),
+					)
+				}
+				panic(p)
+			}
+		}()
+
+		state := &idempotencyState{}
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), idempotencyStateKey{}, state)))
+
+		// 5xx, записанный после фиксации изменений, сохраняется как обычный
+		// ответ: иначе повтор выполнил бы перевод или покупку второй раз.
+		if rec.status >= http.StatusInternalServerError && state.retryable {
+			err = h.Idempotency.Release(ctx, principal.Username, key)
+		} else {
+			err = h.Idempotency.Complete(ctx, principal.Username, key, rec.status, rec.Header().Get("Content-Type"), rec.body.Bytes())
+		}
+		if err != nil {
+			slog.Error("Failed to store idempotent response",
+				slog.String("username", principal.Username),
+				slog.String("error", err.Error()),
+			)
+		}
+	})
+}
+
+type idempotencyState struct {
+	retryable bool
+}
+
+type idempotencyStateKey struct{}
+
+// markRetryable сообщает Idempotent, что запрос упал в сервисе и его
+// транзакция откатилась, поэтому ключ можно освободить для повтора.
+// Вне Idempotent ничего не делает.
+func markRetryable(r *http.Request) {
+	if state, ok := r.Context().Value(idempotencyStateKey{}).(*idempotencyState); ok {
+		state.retryable = true
+	}
+}
+
+// requestFingerprint отличает запросы, отправленные с одним ключом.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder пропускает ответ клиенту и копирует его для сохранения.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+	"time"
+
+	"github.com/titoffon/merch-store/internal/service"
 )
 
 type InfoResponse struct {
@@ -13,96 +17,133 @@ type InfoResponse struct {
 }
 
 type InvItem struct {
-    Type     string `json:"type"`
-    Quantity int64  `json:"quantity"`
+    Type     string      `json:"type"`
+    Quantity int64       `json:"quantity"`
+    Details  []InvDetail `json:"details"`
+}
+
+// InvDetail - строка покупки с ценой, которую заплатил пользователь.
+type InvDetail struct {
+    OrderID     int64     `json:"orderId,omitempty"`
+    Quantity    int64     `json:"quantity"`
+    Price       int64     `json:"price"`
+    Currency    string    `json:"currency"`
+    PurchasedAt time.Time `json:"purchasedAt"`
 }
 
 type CoinHistory struct {
     Received []ReceivedTx `json:"received"`
     Sent     []SentTx     `json:"sent"`
+    Refunds  []RefundTx   `json:"refunds"`
 }
 
 type ReceivedTx struct {
+    ID       int64  `json:"id"`
     FromUser string `json:"fromUser"`
     Amount   int64  `json:"amount"`
+    Message  string `json:"message,omitempty"`
+    Category string `json:"category,omitempty"`
+    Reaction string `json:"reaction,omitempty"`
 }
 
 type SentTx struct {
-    ToUser string `json:"toUser"`
-    Amount int64  `json:"amount"`
+    ID       int64  `json:"id"`
+    ToUser   string `json:"toUser"`
+    Amount   int64  `json:"amount"`
+    Message  string `json:"message,omitempty"`
+    Category string `json:"category,omitempty"`
+    Reaction string `json:"reaction,omitempty"`
+}
+
+// RefundTx - возврат монет за отменённый заказ.
+type RefundTx struct {
+    OrderID   int64     `json:"orderId"`
+    Amount    int64     `json:"amount"`
+    CreatedAt time.Time `json:"createdAt"`
 }
 
 func (h *Handlers) UserInfo(w http.ResponseWriter, r *http.Request) {
-	username, err := ExtractJWT(w, r)
-		if err != nil {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
 		return
 	}
 
-	user, err := h.Dal.GetUserByName(r.Context(), username)
-    if err != nil {
-        slog.Error("Failed to get user by name", slog.String("error", err.Error()))
-        ResponseError(w, http.StatusInternalServerError, "Failed to get user by name")
-        return
-    }
-
-	purchases, err := h.Dal.GetUserPurchases(r.Context(), username)
-    if err != nil {
-        slog.Error("Failed to get user purchases", slog.String("error", err.Error()))
-        ResponseError(w, http.StatusInternalServerError, "Failed to get user purchases")
-        return
-    }
-
-    var inventory []InvItem
-    for _, p := range purchases {
-        inventory = append(inventory, InvItem{
-            Type:     p.MerchItem,
-            Quantity: p.Quantity,
-        })
-    }
-
-	receivedTxs, err := h.Dal.GetTransactionsReceived(r.Context(), username)
-    if err != nil {
-        slog.Error("Failed to get received transactions", slog.String("error", err.Error()))
-        ResponseError(w, http.StatusInternalServerError, "Failed to get received transactions")
-        return
-    }
-    var received []ReceivedTx
-    for _, rt := range receivedTxs {
-        received = append(received, ReceivedTx{
-            FromUser: rt.FromUser,
-            Amount:   rt.Amount,
-        })
-    }
-
-	sentTxs, err := h.Dal.GetTransactionsSent(r.Context(), username)
-    if err != nil {
-        slog.Error("Failed to get sent transactions", slog.String("error", err.Error()))
-        ResponseError(w, http.StatusInternalServerError, "Failed to get sent transactions")
-        return
-    }
-    var sent []SentTx
-    for _, st := range sentTxs {
-        sent = append(sent, SentTx{
-            ToUser: st.ToUser,
-            Amount: st.Amount,
-        })
-    }
+	info, err := h.Account.Info(r.Context(), principal.Username)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			ResponseError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		slog.Error("Failed to get user info", slog.String("error", err.Error()))
+		ResponseError(w, http.StatusInternalServerError, "Failed to get user info")
+		return
+	}
 
+	var inventory []InvItem
+	for _, p := range info.Inventory {
+		details := make([]InvDetail, 0, len(p.Details))
+		for _, d := range p.Details {
+			details = append(details, InvDetail{
+				OrderID:     d.OrderID,
+				Quantity:    d.Quantity,
+				Price:       d.Price,
+				Currency:    d.Currency,
+				PurchasedAt: d.PurchasedAt,
+			})
+		}
+		inventory = append(inventory, InvItem{
+			Type:     p.MerchItem,
+			Quantity: p.Quantity,
+			Details:  details,
+		})
+	}
 
-	resp := InfoResponse{
-        Coins: user.Balance,
-        Inventory: inventory,
-        CoinHistory: CoinHistory{
-            Received: received,
-            Sent:     sent,
-        },
-    }
+	var received []ReceivedTx
+	for _, rt := range info.Received {
+		received = append(received, ReceivedTx{
+			ID:       rt.ID,
+			FromUser: rt.FromUser,
+			Amount:   rt.Amount,
+			Message:  rt.Message,
+			Category: rt.Category,
+			Reaction: rt.Reaction,
+		})
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-    w.WriteHeader(http.StatusOK)
-    if err := json.NewEncoder(w).Encode(resp); err != nil {
-        slog.Error("Failed to encode info response", slog.String("error", err.Error()))
-    }
+	var sent []SentTx
+	for _, st := range info.Sent {
+		sent = append(sent, SentTx{
+			ID:       st.ID,
+			ToUser:   st.ToUser,
+			Amount:   st.Amount,
+			Message:  st.Message,
+			Category: st.Category,
+			Reaction: st.Reaction,
+		})
+	}
+
+	var refunds []RefundTx
+	for _, rf := range info.Refunds {
+		refunds = append(refunds, RefundTx{
+			OrderID:   rf.OrderID,
+			Amount:    rf.Amount,
+			CreatedAt: rf.CreatedAt,
+		})
+	}
 
+	resp := InfoResponse{
+		Coins:     info.Balance,
+		Inventory: inventory,
+		CoinHistory: CoinHistory{
+			Received: received,
+			Sent:     sent,
+			Refunds:  refunds,
+		},
+	}
 
-}
\ No newline at end of file
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("Failed to encode info response", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/titoffon/merch-store/internal/db"
+	"github.com/titoffon/merch-store/internal/service"
+)
+
+type CatalogItemResponse struct {
+	Name        string `json:"name"`
+	Price       int64  `json:"price"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	ImageURL    string `json:"imageUrl"`
+	Available   bool   `json:"available"`
+	// Stock - остаток на складе; null - товар не ограничен.
+	Stock *int64 `json:"stock"`
+}
+
+func toCatalogItemResponse(item db.MerchItem) CatalogItemResponse {
+	return CatalogItemResponse{
+		Name:        item.Name,
+		Price:       item.Price,
+		Description: item.Description,
+		Category:    item.Category,
+		ImageURL:    item.ImageURL,
+		Available:   item.Available(),
+		Stock:       item.Stock,
+	}
+}
+
+// ListMerch отдаёт товары в продаже. Параметры запроса: minPrice, maxPrice,
+// category и sort (name, price или -price).
+func (h *Handlers) ListMerch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := db.MerchFilter{
+		Category: query.Get("category"),
+		Sort:     query.Get("sort"),
+	}
+
+	var err error
+	if filter.MinPrice, err = parsePrice(query.Get("minPrice")); err != nil {
+		ResponseError(w, http.StatusBadRequest, "minPrice must be a number")
+		return
+	}
+	if filter.MaxPrice, err = parsePrice(query.Get("maxPrice")); err != nil {
+		ResponseError(w, http.StatusBadRequest, "maxPrice must be a number")
+		return
+	}
+
+	items, err := h.Catalog.List(r.Context(), filter)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidFilter) {
+			ResponseError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Error("Failed to list merch", slog.String("error", err.Error()))
+		ResponseError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	resp := make([]CatalogItemResponse, 0, len(items))
+	for _, item := range items {
+		resp = append(resp, toCatalogItemResponse(item))
+	}
+	ResponseJSON(w, http.StatusOK, resp)
+}
+
+// GetMerch отдаёт карточку товара. Снятые с продажи товары не показываются.
+func (h *Handlers) GetMerch(w http.ResponseWriter, r *http.Request) {
+	item, err := h.Catalog.Item(r.Context(), chi.URLParam(r, "item"))
+	if err != nil {
+		if errors.Is(err, service.ErrItemNotFound) {
+			ResponseError(w, http.StatusNotFound, "Item not found")
+			return
+		}
+		slog.Error("Failed to get merch item", slog.String("error", err.Error()))
+		ResponseError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if !item.Active {
+		ResponseError(w, http.StatusNotFound, "Item not found")
+		return
+	}
+	ResponseJSON(w, http.StatusOK, toCatalogItemResponse(*item))
+}
+
+func parsePrice(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/titoffon/merch-store/internal/rbac"
+	"github.com/titoffon/merch-store/internal/token"
+)
+
+// Principal - аутентифицированный пользователь текущего запроса.
+type Principal struct {
+	Username string
+	Roles    []string
+	TokenID  string
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext возвращает пользователя, которого положил Authenticate.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Authenticate проверяет Bearer-токен и кладёт Principal в контекст запроса.
+// Запросы без валидного токена получают 401 и до обработчика не доходят.
+func (h *Handlers) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := h.ExtractJWT(w, r)
+		if err != nil {
+			return
+		}
+
+		ctx := WithPrincipal(r.Context(), Principal{
+			Username: claims.Username,
+			Roles:    claims.Roles,
+			TokenID:  claims.ID,
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequirePermission пропускает запрос, только если роли пользователя дают
+// право p. Ставится после Authenticate; без пользователя в контексте - 401,
+// без права - 403.
+func RequirePermission(p rbac.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := requirePrincipal(w, r)
+			if !ok {
+				return
+			}
+			if !rbac.Can(principal.Roles, p) {
+				slog.Warn("Permission denied",
+					slog.String("username", principal.Username),
+					slog.String("permission", string(p)),
+				)
+				ResponseError(w, http.StatusForbidden, "Forbidden")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Deprecated помечает ответы устаревшего маршрута заголовком Deprecation,
+// чтобы клиенты успели перейти на замену до удаления маршрута.
+func Deprecated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ExtractJWT проверяет Bearer-токен из заголовка Authorization. При ошибке
+// ответ клиенту уже записан.
+func (h *Handlers) ExtractJWT(w http.ResponseWriter, r *http.Request) (*token.Claims, error) {
+
+	tokenStr := r.Header.Get("Authorization")
+
+	if tokenStr == "" {
+		slog.Error("Authorization token is required")
+		ResponseError(w, http.StatusUnauthorized, "Authorization token is required")
+		return nil, fmt.Errorf("Authorization token is required")
+	}
+
+	tokenStr = strings.TrimPrefix(tokenStr, "Bearer ")
+
+	claims, err := h.Tokens.Verify(tokenStr)
+	if err != nil {
+		slog.Warn("Invalid token", slog.String("error", err.Error()))
+		ResponseError(w, http.StatusUnauthorized, "Invalid token")
+		return nil, fmt.Errorf("Invalid token")
+	}
+	if claims.Username == "" {
+		ResponseError(w, http.StatusUnauthorized, "Empty Username Plaload")
+		slog.Error("Empty Username Plaload")
+		return nil, fmt.Errorf("Empty Username Plaload")
+	}
+	return claims, nil
+}
+
+// requirePrincipal достаёт пользователя для защищённого обработчика. Если
+// маршрут по ошибке оставили без Authenticate, запрос отклоняется с 401.
+func requirePrincipal(w http.ResponseWriter, r *http.Request) (Principal, bool) {
+	p, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		slog.Error("Protected handler is called without authentication", slog.String("path", r.URL.Path))
+		ResponseError(w, http.StatusUnauthorized, "Authorization token is required")
+	}
+	return p, ok
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/titoffon/merch-store/internal/db/memory"
+	"github.com/titoffon/merch-store/internal/rbac"
+	"github.com/titoffon/merch-store/internal/service"
+)
+
+func TestAuthenticate(t *testing.T) {
+	h := Handlers{Tokens: newTestTokens(t)}
+
+	validToken, err := h.Tokens.Issue("alice")
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+
+	var got Principal
+	var called bool
+	protected := h.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		got, _ = PrincipalFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Run("Valid token => principal in context", func(t *testing.T) {
+		called = false
+		req := httptest.NewRequest(http.MethodGet, "/api/info", nil)
+		req.Header.Set("Authorization", "Bearer "+validToken)
+		rr := httptest.NewRecorder()
+
+		protected.ServeHTTP(rr, req)
+
+		if !called || rr.Code != http.StatusOK {
+			t.Fatalf("expected handler to be called with 200, called=%t code=%d", called, rr.Code)
+		}
+		if got.Username != "alice" {
+			t.Errorf("expected username=alice, got %q", got.Username)
+		}
+		if got.TokenID == "" {
+			t.Error("expected token id in principal")
+		}
+	})
+
+	t.Run("No token => 401, handler is not called", func(t *testing.T) {
+		called = false
+		req := httptest.NewRequest(http.MethodGet, "/api/info", nil)
+		rr := httptest.NewRecorder()
+
+		protected.ServeHTTP(rr, req)
+
+		if called {
+			t.Error("expected handler not to be called")
+		}
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", rr.Code)
+		}
+	})
+}
+
+func TestRequirePrincipalWithoutMiddleware(t *testing.T) {
+	h := Handlers{}
+	req := httptest.NewRequest(http.MethodGet, "/api/info", nil)
+	rr := httptest.NewRecorder()
+
+	h.UserInfo(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for handler without Authenticate, got %d", rr.Code)
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	h := Handlers{Tokens: newTestTokens(t)}
+	protected := h.Authenticate(RequirePermission(rbac.PermUsersUnlock)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name  string
+		roles []string
+		code  int
+	}{
+		{name: "Admin => 200", roles: []string{rbac.RoleAdmin}, code: http.StatusOK},
+		{name: "No roles => 403", roles: nil, code: http.StatusForbidden},
+		{name: "Unknown role => 403", roles: []string{"root"}, code: http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tokenStr, err := h.Tokens.Issue("alice", tc.roles...)
+			if err != nil {
+				t.Fatalf("failed to issue token: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/users/bob/unlock", nil)
+			req.Header.Set("Authorization", "Bearer "+tokenStr)
+			rr := httptest.NewRecorder()
+
+			protected.ServeHTTP(rr, req)
+
+			if rr.Code != tc.code {
+				t.Errorf("expected %d, got %d", tc.code, rr.Code)
+			}
+		})
+	}
+}
+
+func TestIdempotentReleasesKeyOnPanic(t *testing.T) {
+	h := Handlers{
+		Tokens:      newTestTokens(t),
+		Idempotency: service.NewIdempotency(memory.New(), service.IdempotencyConfig{}),
+	}
+	tokenStr, err := h.Tokens.Issue("alice")
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+
+	shouldPanic := true
+	protected := h.Authenticate(h.Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if shouldPanic {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusOK)
+	})))
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/sendCoin", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenStr)
+		req.Header.Set(IdempotencyKeyHeader, "key-1")
+		rr := httptest.NewRecorder()
+		protected.ServeHTTP(rr, req)
+		return rr
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected the panic to reach the caller")
+			}
+		}()
+		serve()
+	}()
+
+	shouldPanic = false
+	if rr := serve(); rr.Code != http.StatusOK {
+		t.Errorf("expected retry with the same key to run, got %d", rr.Code)
+	}
+}
+
+func TestIdempotentReleasesKeyOnlyForRetryableErrors(t *testing.T) {
+	h := Handlers{
+		Tokens:      newTestTokens(t),
+		Idempotency: service.NewIdempotency(memory.New(), service.IdempotencyConfig{}),
+	}
+	tokenStr, err := h.Tokens.Issue("alice")
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+
+	var calls int
+	protected := h.Authenticate(h.Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/api/buy/cup" {
+			markRetryable(r)
+		}
+		ResponseError(w, http.StatusInternalServerError, "Transaction failed")
+	})))
+	serve := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenStr)
+		req.Header.Set(IdempotencyKeyHeader, "key"+strings.ReplaceAll(path, "/", "-"))
+		rr := httptest.NewRecorder()
+		protected.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Сервис откатил транзакцию: повтор выполняется заново.
+	serve("/api/buy/cup")
+	if rr := serve("/api/buy/cup"); rr.Header().Get(IdempotentReplayedHeader) != "" || calls != 2 {
+		t.Errorf("expected retry to run again, calls=%d replayed=%q", calls, rr.Header().Get(IdempotentReplayedHeader))
+	}
+
+	// 5xx без отметки мог случиться после фиксации: повтор получает его же.
+	calls = 0
+	serve("/api/sendCoin")
+	rr := serve("/api/sendCoin")
+	if rr.Code != http.StatusInternalServerError || rr.Header().Get(IdempotentReplayedHeader) != "true" || calls != 1 {
+		t.Errorf("expected stored 500 to be replayed, code=%d calls=%d", rr.Code, calls)
+	}
+}
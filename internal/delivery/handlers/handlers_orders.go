@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/titoffon/merch-store/internal/db"
+	"github.com/titoffon/merch-store/internal/service"
+)
+
+type OrderLineRequest struct {
+	Item     string `json:"item"`
+	Quantity int64  `json:"quantity"`
+}
+
+type CreateOrderRequest struct {
+	Items []OrderLineRequest `json:"items"`
+}
+
+type OrderLineResponse struct {
+	Item     string `json:"item"`
+	Quantity int64  `json:"quantity"`
+	Price    int64  `json:"price"`
+}
+
+type OrderResponse struct {
+	OrderID   int64               `json:"orderId"`
+	Username  string              `json:"username"`
+	Total     int64               `json:"total"`
+	Status    string              `json:"status"`
+	Items     []OrderLineResponse `json:"items"`
+	CreatedAt time.Time           `json:"createdAt"`
+	UpdatedAt time.Time           `json:"updatedAt"`
+}
+
+type OrderStatusRequest struct {
+	Status string `json:"status"`
+}
+
+func toOrderResponse(order db.Order) OrderResponse {
+	resp := OrderResponse{
+		OrderID:   order.ID,
+		Username:  order.Username,
+		Total:     order.Total,
+		Status:    order.Status,
+		Items:     make([]OrderLineResponse, 0, len(order.Lines)),
+		CreatedAt: order.CreatedAt,
+		UpdatedAt: order.UpdatedAt,
+	}
+	for _, l := range order.Lines {
+		resp.Items = append(resp.Items, OrderLineResponse{Item: l.Item, Quantity: l.Quantity, Price: l.Price})
+	}
+	return resp
+}
+
+func respondOrders(w http.ResponseWriter, orders []db.Order) {
+	resp := make([]OrderResponse, 0, len(orders))
+	for _, order := range orders {
+		resp = append(resp, toOrderResponse(order))
+	}
+	ResponseJSON(w, http.StatusOK, resp)
+}
+
+// orderID разбирает {id} из пути. При ошибке ответ уже отправлен.
+func orderID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		ResponseError(w, http.StatusBadRequest, "Invalid order id")
+		return 0, false
+	}
+	return id, true
+}
+
+func respondOrderError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidOrder), errors.Is(err, service.ErrItemNotFound),
+		errors.Is(err, service.ErrInvalidOrderStatus):
+		ResponseError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrInsufficientFunds):
+		ResponseError(w, http.StatusBadRequest, "No enough coins")
+	case errors.Is(err, service.ErrAccountFrozen):
+		ResponseError(w, http.StatusForbidden, "Account is frozen")
+	case errors.Is(err, service.ErrOrderNotFound):
+		ResponseError(w, http.StatusNotFound, "Order not found")
+	case errors.Is(err, service.ErrOutOfStock), errors.Is(err, service.ErrOrderStatusConflict),
+		errors.Is(err, service.ErrCancelWindowExpired):
+		ResponseError(w, http.StatusConflict, err.Error())
+	default:
+		slog.Error("Order request failed", slog.String("error", err.Error()))
+		markRetryable(r)
+		ResponseError(w, http.StatusInternalServerError, "Transaction failed")
+	}
+}
+
+func (h *Handlers) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	var req CreateOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ResponseError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	lines := make([]db.OrderLine, 0, len(req.Items))
+	for _, l := range req.Items {
+		lines = append(lines, db.OrderLine{Item: l.Item, Quantity: l.Quantity})
+	}
+
+	order, err := h.Shop.PlaceOrder(r.Context(), principal.Username, lines)
+	if err != nil {
+		respondOrderError(w, r, err)
+		return
+	}
+	ResponseJSON(w, http.StatusCreated, toOrderResponse(*order))
+}
+
+// ListOrders отдаёт заказы текущего пользователя, новые первыми.
+// Необязательный параметр status отбирает заказы в одном статусе.
+func (h *Handlers) ListOrders(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	orders, err := h.Shop.ListOrders(r.Context(), db.OrderFilter{
+		Username: principal.Username,
+		Status:   r.URL.Query().Get("status"),
+	})
+	if err != nil {
+		respondOrderError(w, r, err)
+		return
+	}
+	respondOrders(w, orders)
+}
+
+func (h *Handlers) GetOrder(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	id, ok := orderID(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := h.Shop.Order(r.Context(), principal.Username, id)
+	if err != nil {
+		respondOrderError(w, r, err)
+		return
+	}
+	ResponseJSON(w, http.StatusOK, toOrderResponse(*order))
+}
+
+// ListOrdersAdmin отдаёт заказы всех пользователей. Параметры status,
+// username и limit сужают выборку.
+func (h *Handlers) ListOrdersAdmin(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := db.OrderFilter{
+		Username: query.Get("username"),
+		Status:   query.Get("status"),
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			ResponseError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	orders, err := h.Shop.ListOrders(r.Context(), filter)
+	if err != nil {
+		respondOrderError(w, r, err)
+		return
+	}
+	respondOrders(w, orders)
+}
+
+func (h *Handlers) SetOrderStatus(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	id, ok := orderID(w, r)
+	if !ok {
+		return
+	}
+
+	var req OrderStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ResponseError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	order, err := h.Shop.AdvanceOrder(r.Context(), principal.Username, id, req.Status)
+	if err != nil {
+		respondOrderError(w, r, err)
+		return
+	}
+	ResponseJSON(w, http.StatusOK, toOrderResponse(*order))
+}
+
+// CancelOrder отменяет заказ текущего пользователя и возвращает монеты.
+func (h *Handlers) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	id, ok := orderID(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := h.Shop.CancelOrder(r.Context(), principal.Username, id)
+	if err != nil {
+		respondOrderError(w, r, err)
+		return
+	}
+	ResponseJSON(w, http.StatusOK, toOrderResponse(*order))
+}
+
+func (h *Handlers) CancelOrderAdmin(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	id, ok := orderID(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := h.Shop.CancelOrderAdmin(r.Context(), principal.Username, id)
+	if err != nil {
+		respondOrderError(w, r, err)
+		return
+	}
+	ResponseJSON(w, http.StatusOK, toOrderResponse(*order))
+}
@@ -6,12 +6,15 @@ import (
 	"log/slog"
 	"net/http"
 
-	"github.com/titoffon/merch-store/internal/db"
+	"github.com/titoffon/merch-store/internal/service"
 )
 
 type SendCoinRequest struct {
-	ToUser  string `json:"toUser"`
-	Amount  int64  `json:"amount"`
+	ToUser string `json:"toUser"`
+	Amount int64  `json:"amount"`
+	// Message и Category - необязательная подпись к переводу.
+	Message  string `json:"message,omitempty"`
+	Category string `json:"category,omitempty"`
 }
 
 func (h *Handlers) SendCoins(w http.ResponseWriter, r *http.Request) {
@@ -27,66 +30,33 @@ func (h *Handlers) SendCoins(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	username, err := ExtractJWT(w, r)
-	if err != nil {
-		return
-	}
-
-	receiver, err := h.Dal.GetUserByName(r.Context(), req.ToUser)
-	if err != nil {
-		ResponseError(w, http.StatusInternalServerError, "Database error")
-		slog.Error("Failed to retrieve receiver", slog.String("toUser", req.ToUser), slog.String("error", err.Error()))
-		return
-	}
-
-	if receiver == nil {
-		ResponseError(w, http.StatusBadRequest, "Receiver user does not exist")
-		return
-	}
-
-	tx, err := h.Dal.DBPool.Begin(r.Context())
-	if err != nil {
-		ResponseError(w, http.StatusInternalServerError, "Transaction start error")
-		slog.Error("Failed to start transaction", slog.String("error", err.Error()))
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
 		return
 	}
-	defer tx.Rollback(r.Context())
 
-	err = h.Dal.MinusUserBalance(r.Context(), username, req.Amount, tx)
+	note := service.TransferNote{Message: req.Message, Category: req.Category}
+	err := h.Wallet.Transfer(r.Context(), principal.Username, req.ToUser, req.Amount, note)
 	if err != nil {
-		if errors.Is(err, db.ErrLowBalance){
-			ResponseError(w, 400, "No enough coins")
-			return
+		switch {
+		case errors.Is(err, service.ErrInvalidTransfer):
+			ResponseError(w, http.StatusBadRequest, "Invalid user or amount")
+		case errors.Is(err, service.ErrInvalidTransferNote):
+			ResponseError(w, http.StatusBadRequest, "Invalid message or category")
+		case errors.Is(err, service.ErrReceiverNotFound):
+			ResponseError(w, http.StatusBadRequest, "Receiver user does not exist")
+		case errors.Is(err, service.ErrInsufficientFunds):
+			ResponseError(w, http.StatusBadRequest, "No enough coins")
+		case errors.Is(err, service.ErrAccountFrozen):
+			ResponseError(w, http.StatusForbidden, "Account is frozen")
+		default:
+			markRetryable(r)
+			ResponseError(w, http.StatusInternalServerError, "Transaction failed")
+			slog.Error("Failed to transfer coins", slog.String("toUser", req.ToUser), slog.String("error", err.Error()))
 		}
-		ResponseError(w, http.StatusInternalServerError, "Transaction failed")
-		slog.Error("Failed to subtract balance", slog.String("error", err.Error()))
-		return
-	}
-
-	err = h.Dal.PlusUserBalance(r.Context(), req.ToUser, req.Amount, tx)
-	if err != nil {
-		ResponseError(w, http.StatusInternalServerError, "Transaction failed")
-		slog.Error("Failed to add balance", slog.String("error", err.Error()))
-		return
-	}
-
-	_, err = h.Dal.InsertTransaction_log(r.Context(), db.TransactionLog{
-		Sender:    username,
-		Recipient: receiver.Username,
-		Amount:    req.Amount,
-	}, tx)
-	if err != nil {
-		ResponseError(w, http.StatusInternalServerError, "Failed to log transaction")
-		slog.Error("Failed to log transaction", slog.String("error", err.Error()))
-		return
-	}
-		
-	err = tx.Commit(r.Context())
-	if err != nil {
-		ResponseError(w, http.StatusInternalServerError, "Failed to commit transaction")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-}
\ No newline at end of file
+}
@@ -2,42 +2,19 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/titoffon/merch-store/internal/token"
 )
 
 
-func TestCheckPassword(t *testing.T) {
-    hashed, err := bcrypt.GenerateFromPassword([]byte("test123"), bcrypt.DefaultCost)
-    if err != nil {
-        t.Fatalf("failed to generate hash: %v", err)
-    }
-
-    ok, err := CheckPassword(string(hashed), "test123")
-    if err != nil {
-        t.Errorf("expected no error, got %v", err)
-    }
-    if !ok {
-        t.Errorf("expected password to match, got false")
-    }
-
-    ok, err = CheckPassword(string(hashed), "wrongPass")
-    if err != nil {
-        t.Errorf("expected no error, got %v", err)
-    }
-    if ok {
-        t.Errorf("expected password mismatch (false), got true")
-    }
-}
-
 func TestResponseError(t *testing.T) {
     rr := httptest.NewRecorder()
 
@@ -84,74 +61,59 @@ func TestResponseJWT(t *testing.T) {
     }
 }
 
-func TestHashedPass(t *testing.T) {
-    password := "mySecretPassword"
+var testJWT = token.Config{
+    Algorithm: token.AlgHS256,
+    KeyID:     "test",
+    Secret:    []byte("testSecretKey"),
+    Issuer:    "merch-store",
+    Audience:  "merch-store",
+    AccessTTL: time.Minute,
+}
 
-    hashed, err := HashedPass(password)
+func newTestTokens(t *testing.T) *token.Manager {
+    t.Helper()
+    tokens, err := token.New(testJWT)
     if err != nil {
-        t.Errorf("expected no error, got %v", err)
-    }
-    if len(hashed) == 0 {
-        t.Error("expected non-empty hashed password")
-    }
-
-    if err := bcrypt.CompareHashAndPassword(hashed, []byte(password)); err != nil {
-        t.Errorf("bcrypt.CompareHashAndPassword should succeed for the correct password, got err=%v", err)
-    }
-
-    if err := bcrypt.CompareHashAndPassword(hashed, []byte("wrong")); err == nil {
-        t.Error("expected error for wrong password, got nil")
+        t.Fatalf("failed to create token manager: %v", err)
     }
+    return tokens
 }
 
-func TestGenerateJWTToken(t *testing.T) {
-    secret := []byte("testSecretKey")
-    username := "testUser"
-
-    tokenStr, err := generateJWTToken(username, secret)
-    if err != nil {
-        t.Errorf("expected no error, got %v", err)
-    }
-    if tokenStr == "" {
-        t.Error("expected non-empty token string")
-    }
+func TestExtractJWT(t *testing.T) {
 
+    slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, nil)))
 
-    parsedToken, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+    h := Handlers{Tokens: newTestTokens(t)}
+    now := time.Now()
 
-        if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-            return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-        }
-        return secret, nil
-    })
-    if err != nil {
-        t.Fatalf("failed to parse token: %v", err)
-    }
-    if !parsedToken.Valid {
-        t.Error("parsed token is invalid")
-    }
+    validToken := createTestJWTToken(t, "validUser", testJWT.Secret, testClaims(now))
 
-    claims, ok := parsedToken.Claims.(jwt.MapClaims)
-    if !ok {
-        t.Fatal("could not cast claims to jwt.MapClaims")
-    }
-    if claims["sub"] != username {
-        t.Errorf("expected sub=%s, got %v", username, claims["sub"])
-    }
-}
+    wrongSignatureToken := createTestJWTToken(t, "userWrongSignature", []byte("otherSecretKey"), testClaims(now))
 
-func TestExtractJWT(t *testing.T) {
+    emptySubToken := createTestJWTToken(t, "", testJWT.Secret, testClaims(now))
 
-    slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, nil)))
+    noExpClaims := testClaims(now)
+    delete(noExpClaims, "exp")
+    noExpToken := createTestJWTToken(t, "validUser", testJWT.Secret, noExpClaims)
 
-    os.Setenv("JWT_SECRET", "testSecretKey")
+    expiredClaims := testClaims(now.Add(-time.Hour))
+    expiredToken := createTestJWTToken(t, "validUser", testJWT.Secret, expiredClaims)
 
+    notYetValidClaims := testClaims(now)
+    notYetValidClaims["nbf"] = now.Add(time.Hour).Unix()
+    notYetValidToken := createTestJWTToken(t, "validUser", testJWT.Secret, notYetValidClaims)
 
-    validToken := createTestJWTToken(t, "validUser", []byte("testSecretKey"))
+    noIatClaims := testClaims(now)
+    delete(noIatClaims, "iat")
+    noIatToken := createTestJWTToken(t, "validUser", testJWT.Secret, noIatClaims)
 
-    wrongSignatureToken := createTestJWTToken(t, "userWrongSignature", []byte("otherSecretKey"))
+    wrongIssuerClaims := testClaims(now)
+    wrongIssuerClaims["iss"] = "someone-else"
+    wrongIssuerToken := createTestJWTToken(t, "validUser", testJWT.Secret, wrongIssuerClaims)
 
-    emptySubToken := createTestJWTToken(t, "", []byte("testSecretKey"))
+    wrongAudienceClaims := testClaims(now)
+    wrongAudienceClaims["aud"] = "employee-portal"
+    wrongAudienceToken := createTestJWTToken(t, "validUser", testJWT.Secret, wrongAudienceClaims)
 
     tests := []struct {
         name            string
@@ -190,6 +152,42 @@ func TestExtractJWT(t *testing.T) {
             wantStatus:     http.StatusUnauthorized,
             wantErrMessage: "Invalid token",
         },
+        {
+            name:           "No exp => 401",
+            authHeaderValue: "Bearer " + noExpToken,
+            wantStatus:     http.StatusUnauthorized,
+            wantErrMessage: "Invalid token",
+        },
+        {
+            name:           "Expired => 401",
+            authHeaderValue: "Bearer " + expiredToken,
+            wantStatus:     http.StatusUnauthorized,
+            wantErrMessage: "Invalid token",
+        },
+        {
+            name:           "Not yet valid => 401",
+            authHeaderValue: "Bearer " + notYetValidToken,
+            wantStatus:     http.StatusUnauthorized,
+            wantErrMessage: "Invalid token",
+        },
+        {
+            name:           "No iat => 401",
+            authHeaderValue: "Bearer " + noIatToken,
+            wantStatus:     http.StatusUnauthorized,
+            wantErrMessage: "Invalid token",
+        },
+        {
+            name:           "Wrong issuer => 401",
+            authHeaderValue: "Bearer " + wrongIssuerToken,
+            wantStatus:     http.StatusUnauthorized,
+            wantErrMessage: "Invalid token",
+        },
+        {
+            name:           "Wrong audience => 401",
+            authHeaderValue: "Bearer " + wrongAudienceToken,
+            wantStatus:     http.StatusUnauthorized,
+            wantErrMessage: "Invalid token",
+        },
     }
 
     for _, tc := range tests {
@@ -202,7 +200,7 @@ func TestExtractJWT(t *testing.T) {
 
             rr := httptest.NewRecorder()
 
-            username, err := ExtractJWT(rr, req)
+            claims, err := h.ExtractJWT(rr, req)
 
             if rr.Code != tc.wantStatus {
                 t.Errorf("expected status %d, got %d", tc.wantStatus, rr.Code)
@@ -213,8 +211,8 @@ func TestExtractJWT(t *testing.T) {
                 if err != nil {
                     t.Errorf("expected no error, got %v", err)
                 }
-                if username != tc.wantUsername {
-                    t.Errorf("expected username=%q, got %q", tc.wantUsername, username)
+                if claims == nil || claims.Username != tc.wantUsername {
+                    t.Errorf("expected username=%q, got %+v", tc.wantUsername, claims)
                 }
             } else {
 
@@ -230,15 +228,24 @@ func TestExtractJWT(t *testing.T) {
     }
 }
 
-func createTestJWTToken(t *testing.T, username string, secret []byte) string {
-    t.Helper()
-    claims := jwt.MapClaims{
-        "sub": username,
+// testClaims - набор обязательных claims для токена, выпущенного в issuedAt.
+func testClaims(issuedAt time.Time) jwt.MapClaims {
+    return jwt.MapClaims{
+        "iss": testJWT.Issuer,
+        "aud": testJWT.Audience,
+        "iat": issuedAt.Unix(),
+        "nbf": issuedAt.Unix(),
+        "exp": issuedAt.Add(testJWT.AccessTTL).Unix(),
     }
+}
+
+func createTestJWTToken(t *testing.T, username string, secret []byte, claims jwt.MapClaims) string {
+    t.Helper()
+    claims["sub"] = username
     token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
     signed, err := token.SignedString(secret)
     if err != nil {
         t.Fatalf("failed to sign token: %v", err)
     }
     return signed
-}
\ No newline at end of file
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/titoffon/merch-store/internal/service"
+)
+
+// TransferReactionRequest - тело PUT /api/transfers/{id}/reaction.
+// Пустая реакция снимает прежнюю.
+type TransferReactionRequest struct {
+	Reaction string `json:"reaction"`
+}
+
+type TransferReactionResponse struct {
+	ID       int64  `json:"id"`
+	Reaction string `json:"reaction"`
+}
+
+// ReactToTransfer ставит реакцию текущего пользователя на полученный перевод.
+func (h *Handlers) ReactToTransfer(w http.ResponseWriter, r *http.Request) {
+	principal, ok := requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		ResponseError(w, http.StatusBadRequest, "Invalid transfer id")
+		return
+	}
+
+	var req TransferReactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ResponseError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	err = h.Wallet.React(r.Context(), principal.Username, id, req.Reaction)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidReaction):
+			ResponseError(w, http.StatusBadRequest, "Unknown reaction")
+		case errors.Is(err, service.ErrTransferNotFound):
+			ResponseError(w, http.StatusNotFound, "Transfer not found")
+		default:
+			slog.Error("Failed to react to transfer", slog.Int64("id", id), slog.String("error", err.Error()))
+			ResponseError(w, http.StatusInternalServerError, "Failed to react to transfer")
+		}
+		return
+	}
+	ResponseJSON(w, http.StatusOK, TransferReactionResponse{ID: id, Reaction: req.Reaction})
+}
@@ -2,21 +2,83 @@ package routes
 
 import (
 	"github.com/go-chi/chi/v5"
+	"github.com/titoffon/merch-store/internal/config"
 	"github.com/titoffon/merch-store/internal/db"
 	"github.com/titoffon/merch-store/internal/delivery/handlers"
+	"github.com/titoffon/merch-store/internal/rbac"
+	"github.com/titoffon/merch-store/internal/service"
+	"github.com/titoffon/merch-store/internal/token"
 )
 
-func NewRouter(dal *db.DB) *chi.Mux {
+func NewRouter(dal db.Storage, cfg *config.Config, tokens *token.Manager) *chi.Mux {
 	r := chi.NewRouter()
 
 	h := handlers.Handlers{
-		Dal: dal,
+		Shop:    service.NewShop(dal, service.ShopConfig{CancelWindow: cfg.OrderCancelWindow}),
+		Wallet:  service.NewWallet(dal),
+		Account: service.NewAccount(dal),
+		Catalog: service.NewCatalog(dal),
+		AuthService: service.NewAuth(dal, service.AuthConfig{
+			RefreshTTL:        cfg.JWTRefreshTTL,
+			AutoRegister:      cfg.AuthAutoRegister,
+			PasswordMinLength: cfg.AuthPasswordMinLength,
+			Lockout: service.LockoutConfig{
+				Threshold:   cfg.AuthLockoutThreshold,
+				IPThreshold: cfg.AuthLockoutIPThreshold,
+				BaseDelay:   cfg.AuthLockoutBaseDelay,
+				MaxDelay:    cfg.AuthLockoutMaxDelay,
+				Window:      cfg.AuthLockoutWindow,
+			},
+		}),
+		Idempotency: service.NewIdempotency(dal, service.IdempotencyConfig{TTL: cfg.IdempotencyTTL}),
+		Tokens:      tokens,
 	}
 
+	r.Post("/api/register", h.Register)
 	r.Post("/api/auth", h.Auth)
-	r.Get("/api/buy/{item}", h.PurchaseMerch)
-	r.Post("/api/sendCoin", h.SendCoins)
-	r.Get("/api/info", h.UserInfo)
-	
+	r.Post("/api/auth/refresh", h.RefreshToken)
+	r.Post("/api/auth/revoke", h.RevokeToken)
+	r.Get("/api/merch", h.ListMerch)
+	r.Get("/api/merch/{item}", h.GetMerch)
+
+	r.Group(func(r chi.Router) {
+		r.Use(h.Authenticate)
+
+		r.With(h.Idempotent).Post("/api/buy/{item}", h.PurchaseMerch)
+		if cfg.LegacyGetBuy {
+			r.With(handlers.Deprecated, h.Idempotent).Get("/api/buy/{item}", h.PurchaseMerch)
+		}
+		r.With(h.Idempotent).Post("/api/orders", h.CreateOrder)
+		r.Get("/api/orders", h.ListOrders)
+		r.Get("/api/orders/{id}", h.GetOrder)
+		r.Post("/api/orders/{id}/cancel", h.CancelOrder)
+		r.With(h.Idempotent).Post("/api/sendCoin", h.SendCoins)
+		r.Put("/api/transfers/{id}/reaction", h.ReactToTransfer)
+		r.Get("/api/info", h.UserInfo)
+
+		r.With(handlers.RequirePermission(rbac.PermUsersUnlock)).Post("/api/admin/users/{username}/unlock", h.UnlockUser)
+		r.With(handlers.RequirePermission(rbac.PermUsersRoles)).Put("/api/admin/users/{username}/roles", h.SetUserRoles)
+
+		r.Route("/api/admin/merch", func(r chi.Router) {
+			r.Use(handlers.RequirePermission(rbac.PermMerchManage))
+
+			r.Get("/", h.ListMerchAdmin)
+			r.Post("/", h.CreateMerchItem)
+			r.Patch("/{item}", h.UpdateMerchItem)
+			r.Delete("/{item}", h.ArchiveMerchItem)
+			r.Post("/{item}/restock", h.RestockMerchItem)
+			r.Put("/{item}/stock", h.SetMerchStock)
+			r.Get("/{item}/history", h.MerchItemHistory)
+		})
+
+		r.Route("/api/admin/orders", func(r chi.Router) {
+			r.Use(handlers.RequirePermission(rbac.PermOrdersManage))
+
+			r.Get("/", h.ListOrdersAdmin)
+			r.Put("/{id}/status", h.SetOrderStatus)
+			r.Post("/{id}/cancel", h.CancelOrderAdmin)
+		})
+	})
+
 	return r
 }
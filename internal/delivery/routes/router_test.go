@@ -0,0 +1,911 @@
+package routes_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/titoffon/merch-store/internal/config"
+	"github.com/titoffon/merch-store/internal/db"
+	"github.com/titoffon/merch-store/internal/db/memory"
+	"github.com/titoffon/merch-store/internal/delivery/handlers"
+	"github.com/titoffon/merch-store/internal/delivery/routes"
+	"github.com/titoffon/merch-store/internal/rbac"
+	"github.com/titoffon/merch-store/internal/service"
+	"github.com/titoffon/merch-store/internal/token"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return newTestServerWithConfig(t, &config.Config{JWTRefreshTTL: time.Hour, AuthAutoRegister: true})
+}
+
+func newTestServerWithConfig(t *testing.T, cfg *config.Config) *httptest.Server {
+	t.Helper()
+	return newTestServerWithStore(t, memory.New(), cfg)
+}
+
+func newTestServerWithStore(t *testing.T, store db.Storage, cfg *config.Config) *httptest.Server {
+	t.Helper()
+
+	tokens, err := token.New(token.Config{
+		Algorithm: token.AlgHS256,
+		KeyID:     "test",
+		Secret:    []byte("testSecretKey"),
+		Issuer:    "merch-store",
+		Audience:  "merch-store",
+		AccessTTL: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("failed to create token manager: %v", err)
+	}
+
+	srv := httptest.NewServer(routes.NewRouter(store, cfg, tokens))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func doJSON(t *testing.T, method, url, token string, body any) *http.Response {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("failed to encode body: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, url, &buf)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to do request: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func login(t *testing.T, srv *httptest.Server, username, password string) string {
+	t.Helper()
+	return loginTokens(t, srv, username, password).Token
+}
+
+func loginTokens(t *testing.T, srv *httptest.Server, username, password string) handlers.AuthResponse {
+	t.Helper()
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/api/auth", "", handlers.AuthRequest{Username: username, Password: password})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("auth %s: expected 200, got %d", username, resp.StatusCode)
+	}
+	var auth handlers.AuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&auth); err != nil {
+		t.Fatalf("failed to decode auth response: %v", err)
+	}
+	return auth
+}
+
+func getInfo(t *testing.T, srv *httptest.Server, token string) handlers.InfoResponse {
+	t.Helper()
+
+	resp := doJSON(t, http.MethodGet, srv.URL+"/api/info", token, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("info: expected 200, got %d", resp.StatusCode)
+	}
+	var info handlers.InfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatalf("failed to decode info response: %v", err)
+	}
+	return info
+}
+
+func TestAuthWithMemoryStorage(t *testing.T) {
+	srv := newTestServer(t)
+
+	login(t, srv, "alice", "alicePass")
+	login(t, srv, "alice", "alicePass")
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/api/auth", "", handlers.AuthRequest{Username: "alice", Password: "wrong"})
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 for wrong password, got %d", resp.StatusCode)
+	}
+}
+
+func TestConcurrentFirstLogin(t *testing.T) {
+	const n = 10
+	srv := newTestServer(t)
+
+	tokens := make([]string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Post(srv.URL+"/api/auth", "application/json", strings.NewReader(`{"username":"racer","password":"racerPass"}`))
+			if err != nil {
+				t.Errorf("failed to do request: %v", err)
+				return
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("expected 200, got %d", resp.StatusCode)
+				return
+			}
+			var auth handlers.AuthResponse
+			if err := json.NewDecoder(resp.Body).Decode(&auth); err != nil {
+				t.Errorf("failed to decode auth response: %v", err)
+				return
+			}
+			tokens[i] = auth.Token
+		}()
+	}
+	wg.Wait()
+	if t.Failed() {
+		t.FailNow()
+	}
+
+	for _, token := range tokens {
+		if info := getInfo(t, srv, token); info.Coins != 1000 {
+			t.Errorf("expected a single wallet with 1000 coins, got %d", info.Coins)
+		}
+	}
+}
+
+func TestRegisterAndStrictLogin(t *testing.T) {
+	srv := newTestServerWithConfig(t, &config.Config{JWTRefreshTTL: time.Hour})
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/api/auth", "", handlers.AuthRequest{Username: "alice", Password: "alicePass1"})
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 for unknown user in strict mode, got %d", resp.StatusCode)
+	}
+
+	tests := []struct {
+		name string
+		req  handlers.AuthRequest
+		code int
+	}{
+		{name: "invalid username", req: handlers.AuthRequest{Username: "a!", Password: "alicePass1"}, code: http.StatusBadRequest},
+		{name: "weak password", req: handlers.AuthRequest{Username: "alice", Password: "short"}, code: http.StatusBadRequest},
+		{name: "success", req: handlers.AuthRequest{Username: "alice", Password: "alicePass1"}, code: http.StatusOK},
+		{name: "duplicate", req: handlers.AuthRequest{Username: "alice", Password: "alicePass1"}, code: http.StatusConflict},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := doJSON(t, http.MethodPost, srv.URL+"/api/register", "", tc.req)
+			if resp.StatusCode != tc.code {
+				t.Errorf("expected %d, got %d", tc.code, resp.StatusCode)
+			}
+		})
+	}
+
+	info := getInfo(t, srv, login(t, srv, "alice", "alicePass1"))
+	if info.Coins != 1000 {
+		t.Errorf("expected 1000 coins after registration, got %d", info.Coins)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	srv := newTestServerWithConfig(t, &config.Config{
+		JWTRefreshTTL:        time.Hour,
+		AuthAutoRegister:     true,
+		AuthLockoutThreshold: 2,
+		AuthLockoutBaseDelay: time.Minute,
+		AuthLockoutMaxDelay:  time.Hour,
+		AuthLockoutWindow:    time.Hour,
+	})
+	login(t, srv, "judy", "judyPass")
+
+	for i := 0; i < 2; i++ {
+		resp := doJSON(t, http.MethodPost, srv.URL+"/api/auth", "", handlers.AuthRequest{Username: "judy", Password: "wrong"})
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", resp.StatusCode)
+		}
+	}
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/api/auth", "", handlers.AuthRequest{Username: "judy", Password: "judyPass"})
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "60" {
+		t.Errorf("expected Retry-After=60, got %q", got)
+	}
+}
+
+func TestAdminRoutes(t *testing.T) {
+	store := memory.New()
+	srv := newTestServerWithStore(t, store, &config.Config{
+		JWTRefreshTTL:        time.Hour,
+		AuthAutoRegister:     true,
+		AuthLockoutThreshold: 1,
+		AuthLockoutBaseDelay: time.Minute,
+		AuthLockoutMaxDelay:  time.Hour,
+		AuthLockoutWindow:    time.Hour,
+	})
+
+	userToken := login(t, srv, "mallory", "malloryPass")
+	login(t, srv, "boss", "bossPass")
+	if err := service.NewAuth(store, service.AuthConfig{}).GrantRole(context.Background(), "boss", rbac.RoleAdmin); err != nil {
+		t.Fatalf("failed to grant admin: %v", err)
+	}
+	adminToken := login(t, srv, "boss", "bossPass")
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/api/auth", "", handlers.AuthRequest{Username: "mallory", Password: "wrong"})
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", resp.StatusCode)
+	}
+
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/admin/users/mallory/unlock", userToken, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for a regular user, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/admin/users/mallory/unlock", adminToken, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/admin/users/ghost/unlock", adminToken, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown user, got %d", resp.StatusCode)
+	}
+	login(t, srv, "mallory", "malloryPass")
+
+	resp = doJSON(t, http.MethodPut, srv.URL+"/api/admin/users/mallory/roles", adminToken, handlers.RolesRequest{Roles: []string{"root"}})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown role, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPut, srv.URL+"/api/admin/users/ghost/roles", adminToken, handlers.RolesRequest{Roles: []string{rbac.RoleAdmin}})
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown user, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPut, srv.URL+"/api/admin/users/mallory/roles", adminToken, handlers.RolesRequest{Roles: []string{rbac.RoleAdmin}})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	// Новая роль попадает в токен при следующем входе.
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/admin/users/boss/unlock", login(t, srv, "mallory", "malloryPass"), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 for the new admin, got %d", resp.StatusCode)
+	}
+}
+
+func TestAdminMerchRoutes(t *testing.T) {
+	store := memory.New()
+	srv := newTestServerWithStore(t, store, &config.Config{JWTRefreshTTL: time.Hour, AuthAutoRegister: true})
+
+	userToken := login(t, srv, "shopper", "shopperPass")
+	login(t, srv, "hr", "hrPass")
+	if err := service.NewAuth(store, service.AuthConfig{}).GrantRole(context.Background(), "hr", rbac.RoleAdmin); err != nil {
+		t.Fatalf("failed to grant admin: %v", err)
+	}
+	adminToken := login(t, srv, "hr", "hrPass")
+
+	sticker := handlers.CreateMerchItemRequest{Name: "sticker", Price: 5, Category: "office"}
+	resp := doJSON(t, http.MethodPost, srv.URL+"/api/admin/merch", userToken, sticker)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for a regular user, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/admin/merch", adminToken, handlers.CreateMerchItemRequest{Name: "Bad Name", Price: 5})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid item, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/admin/merch", adminToken, sticker)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/admin/merch", adminToken, sticker)
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 for a duplicate item, got %d", resp.StatusCode)
+	}
+
+	price := int64(9)
+	resp = doJSON(t, http.MethodPatch, srv.URL+"/api/admin/merch/sticker", adminToken, handlers.UpdateMerchItemRequest{Price: &price})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var item handlers.MerchItemResponse
+	if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+		t.Fatalf("failed to decode item: %v", err)
+	}
+	if item.Price != 9 || item.Category != "office" || !item.Active {
+		t.Errorf("unexpected item after update: %+v", item)
+	}
+
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/buy/sticker", userToken, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the new item to be on sale, got %d", resp.StatusCode)
+	}
+
+	stock := int64(0)
+	resp = doJSON(t, http.MethodPut, srv.URL+"/api/admin/merch/sticker/stock", adminToken, handlers.SetStockRequest{Stock: &stock})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/buy/sticker", userToken, nil)
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 for an item out of stock, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/admin/merch/sticker/restock", adminToken, handlers.RestockRequest{Quantity: 0})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a zero restock, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/admin/merch/sticker/restock", adminToken, handlers.RestockRequest{Quantity: 2})
+	if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+		t.Fatalf("failed to decode item: %v", err)
+	}
+	if item.Stock == nil || *item.Stock != 2 {
+		t.Errorf("expected stock 2 after restock, got %v", item.Stock)
+	}
+
+	resp = doJSON(t, http.MethodDelete, srv.URL+"/api/admin/merch/sticker", adminToken, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/buy/sticker", userToken, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected archived item not to be sold, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodGet, srv.URL+"/api/merch/sticker", "", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected archived item to be hidden from the catalog, got %d", resp.StatusCode)
+	}
+	if info := getInfo(t, srv, userToken); len(info.Inventory) != 1 || info.Inventory[0].Type != "sticker" {
+		t.Errorf("expected the purchase to stay in the inventory, got %v", info.Inventory)
+	}
+
+	resp = doJSON(t, http.MethodGet, srv.URL+"/api/admin/merch", adminToken, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var items []handlers.MerchItemResponse
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		t.Fatalf("failed to decode items: %v", err)
+	}
+	if len(items) != len(memory.DefaultMerch)+1 {
+		t.Errorf("expected archived items in the admin list, got %d items", len(items))
+	}
+
+	resp = doJSON(t, http.MethodGet, srv.URL+"/api/admin/merch/sticker/history", adminToken, nil)
+	var history []handlers.AuditEntryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		t.Fatalf("failed to decode history: %v", err)
+	}
+	if len(history) != 5 || history[0].Action != service.AuditMerchArchive || history[0].Actor != "hr" {
+		t.Errorf("unexpected history: %+v", history)
+	}
+}
+
+func TestPublicCatalog(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp := doJSON(t, http.MethodGet, srv.URL+"/api/merch?maxPrice=20&sort=-price", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var items []handlers.CatalogItemResponse
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		t.Fatalf("failed to decode catalog: %v", err)
+	}
+	if len(items) != 3 || items[0].Name != "cup" || items[1].Name != "pen" || items[2].Name != "socks" {
+		t.Errorf("unexpected catalog: %+v", items)
+	}
+	for _, item := range items {
+		if !item.Available {
+			t.Errorf("expected %s to be available", item.Name)
+		}
+	}
+
+	for _, query := range []string{"minPrice=abc", "sort=random", "minPrice=30&maxPrice=10"} {
+		resp := doJSON(t, http.MethodGet, srv.URL+"/api/merch?"+query, "", nil)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, resp.StatusCode)
+		}
+	}
+
+	resp = doJSON(t, http.MethodGet, srv.URL+"/api/merch/hoody", "", nil)
+	var hoody handlers.CatalogItemResponse
+	if err := json.NewDecoder(resp.Body).Decode(&hoody); err != nil {
+		t.Fatalf("failed to decode item: %v", err)
+	}
+	if hoody.Name != "hoody" || hoody.Price != 300 {
+		t.Errorf("unexpected item: %+v", hoody)
+	}
+
+	resp = doJSON(t, http.MethodGet, srv.URL+"/api/merch/unknown", "", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown item, got %d", resp.StatusCode)
+	}
+}
+
+func TestPurchaseMerchWithMemoryStorage(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "buyer", "buyerPass")
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/api/buy/hoody", token, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/buy/unknown", token, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown item, got %d", resp.StatusCode)
+	}
+
+	for i := 0; i < 2; i++ {
+		resp = doJSON(t, http.MethodPost, srv.URL+"/api/buy/pink-hoody", token, nil)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 when coins run out, got %d", resp.StatusCode)
+	}
+
+	info := getInfo(t, srv, token)
+	if info.Coins != 200 {
+		t.Errorf("expected 200 coins, got %d", info.Coins)
+	}
+	if len(info.Inventory) != 2 {
+		t.Fatalf("expected 2 inventory items, got %v", info.Inventory)
+	}
+}
+
+func TestCreateOrder(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "buyer", "buyerPass")
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/api/orders", token, handlers.CreateOrderRequest{
+		Items: []handlers.OrderLineRequest{{Item: "pen", Quantity: 5}, {Item: "cup", Quantity: 2}},
+	})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	var order handlers.OrderResponse
+	if err := json.NewDecoder(resp.Body).Decode(&order); err != nil {
+		t.Fatalf("failed to decode order: %v", err)
+	}
+	if order.OrderID == 0 || order.Total != 90 || order.Status != db.OrderPlaced || len(order.Items) != 2 {
+		t.Errorf("unexpected order: %+v", order)
+	}
+
+	cases := []struct {
+		name  string
+		items []handlers.OrderLineRequest
+		code  int
+	}{
+		{"empty cart", nil, http.StatusBadRequest},
+		{"negative quantity", []handlers.OrderLineRequest{{Item: "pen", Quantity: -1}}, http.StatusBadRequest},
+		{"unknown item", []handlers.OrderLineRequest{{Item: "unknown", Quantity: 1}}, http.StatusBadRequest},
+		{"not enough coins", []handlers.OrderLineRequest{{Item: "pink-hoody", Quantity: 2}}, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		resp := doJSON(t, http.MethodPost, srv.URL+"/api/orders", token, handlers.CreateOrderRequest{Items: c.items})
+		if resp.StatusCode != c.code {
+			t.Errorf("%s: expected %d, got %d", c.name, c.code, resp.StatusCode)
+		}
+	}
+
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/orders", "", handlers.CreateOrderRequest{})
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", resp.StatusCode)
+	}
+
+	info := getInfo(t, srv, token)
+	if info.Coins != 910 {
+		t.Errorf("expected 910 coins, got %d", info.Coins)
+	}
+	if len(info.Inventory) != 2 {
+		t.Errorf("expected 2 inventory items, got %v", info.Inventory)
+	}
+}
+
+func TestOrderRoutes(t *testing.T) {
+	store := memory.New()
+	srv := newTestServerWithStore(t, store, &config.Config{JWTRefreshTTL: time.Hour, AuthAutoRegister: true})
+
+	userToken := login(t, srv, "buyer", "buyerPass")
+	otherToken := login(t, srv, "other", "otherPass")
+	login(t, srv, "boss", "bossPass")
+	if err := service.NewAuth(store, service.AuthConfig{}).GrantRole(context.Background(), "boss", rbac.RoleAdmin); err != nil {
+		t.Fatalf("failed to grant admin: %v", err)
+	}
+	adminToken := login(t, srv, "boss", "bossPass")
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/api/orders", userToken, handlers.CreateOrderRequest{
+		Items: []handlers.OrderLineRequest{{Item: "socks", Quantity: 2}},
+	})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	var created handlers.OrderResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("failed to decode order: %v", err)
+	}
+	orderURL := fmt.Sprintf("%s/api/orders/%d", srv.URL, created.OrderID)
+	statusURL := fmt.Sprintf("%s/api/admin/orders/%d/status", srv.URL, created.OrderID)
+
+	resp = doJSON(t, http.MethodGet, orderURL, otherToken, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for someone else's order, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodGet, srv.URL+"/api/orders/abc", userToken, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad id, got %d", resp.StatusCode)
+	}
+
+	resp = doJSON(t, http.MethodPut, statusURL, userToken, handlers.OrderStatusRequest{Status: db.OrderReady})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for a regular user, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPut, statusURL, adminToken, handlers.OrderStatusRequest{Status: "shipped"})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown status, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPut, statusURL, adminToken, handlers.OrderStatusRequest{Status: db.OrderHandedOver})
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 when skipping ready, got %d", resp.StatusCode)
+	}
+
+	resp = doJSON(t, http.MethodGet, srv.URL+"/api/admin/orders?status=placed", adminToken, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var placed []handlers.OrderResponse
+	if err := json.NewDecoder(resp.Body).Decode(&placed); err != nil {
+		t.Fatalf("failed to decode orders: %v", err)
+	}
+	if len(placed) != 1 || placed[0].Username != "buyer" {
+		t.Errorf("unexpected placed orders: %+v", placed)
+	}
+
+	resp = doJSON(t, http.MethodPut, statusURL, adminToken, handlers.OrderStatusRequest{Status: db.OrderReady})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	resp = doJSON(t, http.MethodGet, srv.URL+"/api/orders?status=ready", userToken, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var mine []handlers.OrderResponse
+	if err := json.NewDecoder(resp.Body).Decode(&mine); err != nil {
+		t.Fatalf("failed to decode orders: %v", err)
+	}
+	if len(mine) != 1 || mine[0].OrderID != created.OrderID || mine[0].Items[0].Quantity != 2 {
+		t.Errorf("unexpected orders: %+v", mine)
+	}
+}
+
+func TestCancelOrderRoutes(t *testing.T) {
+	store := memory.New()
+	srv := newTestServerWithStore(t, store, &config.Config{
+		JWTRefreshTTL:     time.Hour,
+		AuthAutoRegister:  true,
+		OrderCancelWindow: time.Hour,
+	})
+
+	userToken := login(t, srv, "buyer", "buyerPass")
+	login(t, srv, "boss", "bossPass")
+	if err := service.NewAuth(store, service.AuthConfig{}).GrantRole(context.Background(), "boss", rbac.RoleAdmin); err != nil {
+		t.Fatalf("failed to grant admin: %v", err)
+	}
+	adminToken := login(t, srv, "boss", "bossPass")
+
+	placeOrder := func() int64 {
+		t.Helper()
+		resp := doJSON(t, http.MethodPost, srv.URL+"/api/orders", userToken, handlers.CreateOrderRequest{
+			Items: []handlers.OrderLineRequest{{Item: "hoody", Quantity: 1}},
+		})
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("expected 201, got %d", resp.StatusCode)
+		}
+		var order handlers.OrderResponse
+		if err := json.NewDecoder(resp.Body).Decode(&order); err != nil {
+			t.Fatalf("failed to decode order: %v", err)
+		}
+		return order.OrderID
+	}
+
+	first := placeOrder()
+	resp := doJSON(t, http.MethodPost, fmt.Sprintf("%s/api/orders/%d/cancel", srv.URL, first), userToken, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, fmt.Sprintf("%s/api/orders/%d/cancel", srv.URL, first), userToken, nil)
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 for a cancelled order, got %d", resp.StatusCode)
+	}
+
+	second := placeOrder()
+	resp = doJSON(t, http.MethodPut, fmt.Sprintf("%s/api/admin/orders/%d/status", srv.URL, second), adminToken, handlers.OrderStatusRequest{Status: db.OrderReady})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, fmt.Sprintf("%s/api/orders/%d/cancel", srv.URL, second), userToken, nil)
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 for a ready order, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, fmt.Sprintf("%s/api/admin/orders/%d/cancel", srv.URL, second), userToken, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for a regular user, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, fmt.Sprintf("%s/api/admin/orders/%d/cancel", srv.URL, second), adminToken, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	info := getInfo(t, srv, userToken)
+	if info.Coins != 1000 || len(info.Inventory) != 0 {
+		t.Errorf("expected a full refund, got %d coins and %v", info.Coins, info.Inventory)
+	}
+	refunds := info.CoinHistory.Refunds
+	if len(refunds) != 2 || refunds[0].OrderID != second || refunds[1].OrderID != first || refunds[0].Amount != 300 {
+		t.Errorf("unexpected refunds: %+v", refunds)
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "payer", "payerPass")
+	login(t, srv, "payee", "payeePass")
+
+	send := func(key string, amount int64) *http.Response {
+		t.Helper()
+		body, _ := json.Marshal(handlers.SendCoinRequest{ToUser: "payee", Amount: amount})
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/sendCoin", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(handlers.IdempotencyKeyHeader, key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	for i := 0; i < 3; i++ {
+		resp := send("transfer-1", 100)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("attempt %d: expected 200, got %d", i, resp.StatusCode)
+		}
+		if replayed := resp.Header.Get(handlers.IdempotentReplayedHeader) == "true"; replayed != (i > 0) {
+			t.Errorf("attempt %d: unexpected %s header %q", i, handlers.IdempotentReplayedHeader, resp.Header.Get(handlers.IdempotentReplayedHeader))
+		}
+	}
+	if resp := send("transfer-1", 200); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for a different request, got %d", resp.StatusCode)
+	}
+	if resp := send("bad key", 100); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid key, got %d", resp.StatusCode)
+	}
+
+	// Ошибки бизнес-правил тоже запоминаются: повтор не спишет монеты,
+	// даже если к тому времени их станет достаточно.
+	if resp := send("transfer-2", 5000); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", resp.StatusCode)
+	}
+	if resp := send("transfer-2", 5000); resp.StatusCode != http.StatusBadRequest || resp.Header.Get(handlers.IdempotentReplayedHeader) != "true" {
+		t.Errorf("expected a replayed 400, got %d", resp.StatusCode)
+	}
+
+	buy := func() *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/buy/cup", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(handlers.IdempotencyKeyHeader, "buy-cup-1")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	for i := 0; i < 2; i++ {
+		if resp := buy(); resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+	}
+
+	info := getInfo(t, srv, token)
+	if info.Coins != 1000-100-20 {
+		t.Errorf("expected one transfer and one purchase to be charged, got %d coins", info.Coins)
+	}
+}
+
+func TestLegacyGetBuy(t *testing.T) {
+	srv := newTestServer(t)
+	token := login(t, srv, "buyer", "buyerPass")
+
+	resp := doJSON(t, http.MethodGet, srv.URL+"/api/buy/cup", token, nil)
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 when legacy GET is disabled, got %d", resp.StatusCode)
+	}
+
+	srv = newTestServerWithConfig(t, &config.Config{JWTRefreshTTL: time.Hour, AuthAutoRegister: true, LegacyGetBuy: true})
+	token = login(t, srv, "buyer", "buyerPass")
+	resp = doJSON(t, http.MethodGet, srv.URL+"/api/buy/cup", token, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Deprecation") != "true" {
+		t.Errorf("expected Deprecation header, got %q", resp.Header.Get("Deprecation"))
+	}
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/buy/cup", token, nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Deprecation") != "" {
+		t.Errorf("expected POST to succeed without Deprecation header, got %d %q", resp.StatusCode, resp.Header.Get("Deprecation"))
+	}
+}
+
+func TestSendCoinsWithMemoryStorage(t *testing.T) {
+	srv := newTestServer(t)
+	senderToken := login(t, srv, "sender", "senderPass")
+	receiverToken := login(t, srv, "receiver", "receiverPass")
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/api/sendCoin", senderToken, handlers.SendCoinRequest{ToUser: "receiver", Amount: 150})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/sendCoin", senderToken, handlers.SendCoinRequest{ToUser: "ghost", Amount: 10})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown receiver, got %d", resp.StatusCode)
+	}
+
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/sendCoin", senderToken, handlers.SendCoinRequest{ToUser: "receiver", Amount: 5000})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for low balance, got %d", resp.StatusCode)
+	}
+
+	sender := getInfo(t, srv, senderToken)
+	if sender.Coins != 850 {
+		t.Errorf("expected sender to have 850 coins, got %d", sender.Coins)
+	}
+	if len(sender.CoinHistory.Sent) != 1 || sender.CoinHistory.Sent[0].ToUser != "receiver" {
+		t.Errorf("unexpected sent history: %v", sender.CoinHistory.Sent)
+	}
+
+	receiver := getInfo(t, srv, receiverToken)
+	if receiver.Coins != 1150 {
+		t.Errorf("expected receiver to have 1150 coins, got %d", receiver.Coins)
+	}
+	if len(receiver.CoinHistory.Received) != 1 || receiver.CoinHistory.Received[0].FromUser != "sender" {
+		t.Errorf("unexpected received history: %v", receiver.CoinHistory.Received)
+	}
+}
+
+func TestFrozenAccount(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	srv := newTestServerWithStore(t, store, &config.Config{JWTRefreshTTL: time.Hour, AuthAutoRegister: true})
+	token := login(t, srv, "sender", "senderPass")
+	login(t, srv, "receiver", "receiverPass")
+
+	tx, err := store.Begin(ctx)
+	if err != nil {
+		t.Fatalf("failed to begin: %v", err)
+	}
+	if err := tx.SetUserFrozen(ctx, "sender", true); err != nil {
+		t.Fatalf("failed to freeze: %v", err)
+	}
+	tx.Commit(ctx)
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/api/sendCoin", token, handlers.SendCoinRequest{ToUser: "receiver", Amount: 10})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for a transfer from a frozen account, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/buy/cup", token, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for a purchase from a frozen account, got %d", resp.StatusCode)
+	}
+	if info := getInfo(t, srv, token); info.Coins != 1000 {
+		t.Errorf("expected balance to stay 1000, got %d", info.Coins)
+	}
+}
+
+func TestTransferNotesAndReactions(t *testing.T) {
+	srv := newTestServer(t)
+	sender := login(t, srv, "sender", "senderPass")
+	receiver := login(t, srv, "receiver", "receiverPass")
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/api/sendCoin", sender, handlers.SendCoinRequest{
+		ToUser: "receiver", Amount: 10, Message: "thanks for the review", Category: "vacation",
+	})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown category, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/sendCoin", sender, handlers.SendCoinRequest{
+		ToUser: "receiver", Amount: 10, Message: "  thanks for the review ", Category: "help",
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	info := getInfo(t, srv, receiver)
+	if len(info.CoinHistory.Received) != 1 {
+		t.Fatalf("expected one received transfer, got %+v", info.CoinHistory.Received)
+	}
+	got := info.CoinHistory.Received[0]
+	if got.Message != "thanks for the review" || got.Category != "help" || got.Reaction != "" {
+		t.Errorf("unexpected received transfer: %+v", got)
+	}
+
+	url := fmt.Sprintf("%s/api/transfers/%d/reaction", srv.URL, got.ID)
+	tests := []struct {
+		name     string
+		url      string
+		token    string
+		reaction string
+		want     int
+	}{
+		{name: "unknown reaction", url: url, token: receiver, reaction: "angry", want: http.StatusBadRequest},
+		{name: "invalid id", url: srv.URL + "/api/transfers/abc/reaction", token: receiver, reaction: "heart", want: http.StatusBadRequest},
+		{name: "sender cannot react", url: url, token: sender, reaction: "heart", want: http.StatusNotFound},
+		{name: "unknown transfer", url: srv.URL + "/api/transfers/999/reaction", token: receiver, reaction: "heart", want: http.StatusNotFound},
+		{name: "green", url: url, token: receiver, reaction: "heart", want: http.StatusOK},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := doJSON(t, http.MethodPut, tc.url, tc.token, handlers.TransferReactionRequest{Reaction: tc.reaction})
+			if resp.StatusCode != tc.want {
+				t.Errorf("expected %d, got %d", tc.want, resp.StatusCode)
+			}
+		})
+	}
+
+	sent := getInfo(t, srv, sender).CoinHistory.Sent
+	if len(sent) != 1 || sent[0].ID != got.ID || sent[0].Reaction != "heart" || sent[0].Message != "thanks for the review" {
+		t.Errorf("expected the sender to see the reaction, got %+v", sent)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	srv := newTestServer(t)
+	tokens := loginTokens(t, srv, "carol", "carolPass")
+	if tokens.RefreshToken == "" {
+		t.Fatal("expected refresh token in auth response")
+	}
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/api/auth/refresh", "", handlers.RefreshRequest{RefreshToken: tokens.RefreshToken})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var rotated handlers.AuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rotated); err != nil {
+		t.Fatalf("failed to decode refresh response: %v", err)
+	}
+	if rotated.RefreshToken == "" || rotated.RefreshToken == tokens.RefreshToken {
+		t.Fatal("expected a new refresh token")
+	}
+	getInfo(t, srv, rotated.Token)
+
+	// Повторное использование старого токена отзывает всю цепочку.
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/auth/refresh", "", handlers.RefreshRequest{RefreshToken: tokens.RefreshToken})
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 for reused token, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/auth/refresh", "", handlers.RefreshRequest{RefreshToken: rotated.RefreshToken})
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 after family revocation, got %d", resp.StatusCode)
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	srv := newTestServer(t)
+	tokens := loginTokens(t, srv, "dave", "davePass")
+
+	resp := doJSON(t, http.MethodPost, srv.URL+"/api/auth/revoke", "", handlers.RefreshRequest{RefreshToken: tokens.RefreshToken})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	resp = doJSON(t, http.MethodPost, srv.URL+"/api/auth/refresh", "", handlers.RefreshRequest{RefreshToken: tokens.RefreshToken})
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 for revoked token, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,71 @@
+package migrate_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/titoffon/merch-store/internal/migrate"
+	"github.com/titoffon/merch-store/migrations"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_orders.up.sql":   {Data: []byte("CREATE TABLE orders ();")},
+		"0001_init.up.sql":     {Data: []byte("CREATE TABLE users ();")},
+		"0001_init.down.sql":   {Data: []byte("DROP TABLE users;")},
+		"0002_orders.down.sql": {Data: []byte("DROP TABLE orders;")},
+	}
+
+	got, err := migrate.Load(fsys)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 migrations, got %d", len(got))
+	}
+	if got[0].Version != 1 || got[0].Name != "init" || got[0].Down != "DROP TABLE users;" {
+		t.Errorf("unexpected first migration: %+v", got[0])
+	}
+	if got[1].Version != 2 || got[1].Name != "orders" {
+		t.Errorf("unexpected second migration: %+v", got[1])
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{name: "no direction", fsys: fstest.MapFS{"0001_init.sql": {}}},
+		{name: "no name", fsys: fstest.MapFS{"0001.up.sql": {}}},
+		{name: "bad version", fsys: fstest.MapFS{"first_init.up.sql": {}}},
+		{name: "down without up", fsys: fstest.MapFS{"0001_init.down.sql": {Data: []byte("DROP TABLE users;")}}},
+		{name: "conflicting names", fsys: fstest.MapFS{
+			"0001_init.up.sql":  {Data: []byte("SELECT 1;")},
+			"0001_other.up.sql": {Data: []byte("SELECT 1;")},
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := migrate.Load(tc.fsys); err == nil {
+				t.Error("expected an error, got nil")
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	got, err := migrate.Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("expected embedded migrations to load, got %v", err)
+	}
+	for i, m := range got {
+		if m.Version != int64(i+1) {
+			t.Errorf("expected migration versions without gaps, got %d at position %d", m.Version, i)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Package rbac описывает роли пользователей и права, которые они дают.
+// Маршруты проверяют права, а не роли, поэтому новую роль можно завести,
+// не трогая обработчики.
+package rbac
+
+import "slices"
+
+const RoleAdmin = "admin"
+
+type Permission string
+
+const (
+	// PermUsersUnlock - снимать блокировку входа.
+	PermUsersUnlock Permission = "users:unlock"
+	// PermUsersRoles - назначать роли пользователям.
+	PermUsersRoles Permission = "users:roles"
+	// PermMerchManage - вести каталог мерча.
+	PermMerchManage Permission = "merch:manage"
+	// PermOrdersManage - видеть все заказы и менять их статус.
+	PermOrdersManage Permission = "orders:manage"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {PermUsersUnlock, PermUsersRoles, PermMerchManage, PermOrdersManage},
+}
+
+// Can сообщает, даёт ли хотя бы одна из ролей право p.
+func Can(roles []string, p Permission) bool {
+	for _, role := range roles {
+		if slices.Contains(rolePermissions[role], p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid сообщает, известна ли роль.
+func Valid(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
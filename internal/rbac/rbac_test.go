@@ -0,0 +1,28 @@
+package rbac_test
+
+import (
+	"testing"
+
+	"github.com/titoffon/merch-store/internal/rbac"
+)
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		name  string
+		roles []string
+		perm  rbac.Permission
+		want  bool
+	}{
+		{name: "admin", roles: []string{rbac.RoleAdmin}, perm: rbac.PermUsersUnlock, want: true},
+		{name: "no roles", roles: nil, perm: rbac.PermUsersUnlock, want: false},
+		{name: "unknown role", roles: []string{"root"}, perm: rbac.PermUsersRoles, want: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := rbac.Can(tc.roles, tc.perm); got != tc.want {
+				t.Errorf("expected %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
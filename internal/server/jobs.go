@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// idempotencyPurgeInterval - как часто удаляются истёкшие ключи идемпотентности.
+const idempotencyPurgeInterval = time.Hour
+
+// loginFailurePurgeInterval - как часто удаляются устаревшие счётчики неудачных входов.
+const loginFailurePurgeInterval = time.Hour
+
+// runEvery запускает job каждые interval, пока не отменён ctx. Ошибки
+// пишутся в лог и не останавливают следующие запуски.
+func runEvery(ctx context.Context, wg *sync.WaitGroup, interval time.Duration, name string, job func(context.Context) error) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := job(ctx); err != nil && ctx.Err() == nil {
+					slog.Error("Background job failed", slog.String("job", name), slog.String("error", err.Error()))
+				}
+			}
+		}
+	}()
+}
+
+// runDaily запускает job каждый день в момент at после полуночи UTC, пока
+// не отменён ctx. job получает запланированное время запуска: у всех
+// экземпляров сервиса оно одинаковое, поэтому по нему можно договориться,
+// кто выполняет запуск.
+func runDaily(ctx context.Context, wg *sync.WaitGroup, at time.Duration, name string, job func(ctx context.Context, slot time.Time) error) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			slot := nextDailyRun(time.Now(), at)
+			timer := time.NewTimer(time.Until(slot))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+				if err := job(ctx, slot); err != nil && ctx.Err() == nil {
+					slog.Error("Background job failed", slog.String("job", name), slog.String("error", err.Error()))
+				}
+			}
+		}
+	}()
+}
+
+// nextDailyRun возвращает ближайший после now момент at после полуночи UTC.
+func nextDailyRun(now time.Time, at time.Duration) time.Time {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Add(at)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
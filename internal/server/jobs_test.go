@@ -0,0 +1,25 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextDailyRun(t *testing.T) {
+	at := 3 * time.Hour
+	cases := []struct {
+		now  time.Time
+		want time.Time
+	}{
+		{time.Date(2025, 2, 1, 1, 0, 0, 0, time.UTC), time.Date(2025, 2, 1, 3, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 2, 1, 3, 0, 0, 0, time.UTC), time.Date(2025, 2, 2, 3, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 2, 28, 23, 0, 0, 0, time.UTC), time.Date(2025, 3, 1, 3, 0, 0, 0, time.UTC)},
+		// Время сверки задаётся по UTC, а не по часовому поясу процесса.
+		{time.Date(2025, 2, 1, 5, 0, 0, 0, time.FixedZone("MSK", 3*60*60)), time.Date(2025, 2, 1, 3, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		if got := nextDailyRun(c.now, at); !got.Equal(c.want) {
+			t.Errorf("nextDailyRun(%s) = %s, want %s", c.now, got, c.want)
+		}
+	}
+}
@@ -2,43 +2,154 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/titoffon/merch-store/internal/config"
 	"github.com/titoffon/merch-store/internal/db"
+	"github.com/titoffon/merch-store/internal/db/memory"
 	"github.com/titoffon/merch-store/internal/delivery/routes"
+	"github.com/titoffon/merch-store/internal/migrate"
+	"github.com/titoffon/merch-store/internal/service"
+	"github.com/titoffon/merch-store/internal/token"
+	"github.com/titoffon/merch-store/migrations"
 	"github.com/titoffon/merch-store/pkg/logger"
 )
 
-func Run(cfg *config.Config ) error{
+// Run поднимает HTTP-сервер и блокируется до отмены ctx. После отмены
+// сервер перестаёт принимать соединения, ждёт активные запросы не дольше
+// cfg.ShutdownTimeout и только затем закрывает хранилище.
+func Run(ctx context.Context, cfg *config.Config) error {
 	logger.InitGlobalLogger(cfg.LogLevel)
 
-	connectionString := fmt.Sprintf("postgresql://%s:%s@%s:%s/%s?sslmode=disable",
-		cfg.DBUser,
-		cfg.DBPassword,
-		cfg.DBHost,
-		cfg.DBPort,
-		cfg.DBName,
-	)
-
-	ctx := context.Background()
+	tokens, err := token.NewFromConfig(cfg)
+	if err != nil {
+		slog.Error("failed to configure tokens", slog.String("error", err.Error()))
+		return err
+	}
 
-	dal, err := db.New(ctx, connectionString)
+	dal, err := newStorage(ctx, cfg)
 	if err != nil {
-		slog.Error("failed to coыnnect to database: %v", slog.String("error", err.Error()))
+		slog.Error("failed to connect to database", slog.String("error", err.Error()))
+		return err
+	}
+	defer func() {
+		dal.Close()
+		slog.Info("Storage is closed")
+	}()
+
+	// Фоновые задачи останавливаются вместе с сервером, до закрытия хранилища.
+	var jobs sync.WaitGroup
+	defer jobs.Wait()
+	jobsCtx, stopJobs := context.WithCancel(ctx)
+	defer stopJobs()
+	idempotency := service.NewIdempotency(dal, service.IdempotencyConfig{TTL: cfg.IdempotencyTTL})
+	runEvery(jobsCtx, &jobs, idempotencyPurgeInterval, "purge idempotency keys", func(ctx context.Context) error {
+		n, err := idempotency.Purge(ctx)
+		if err == nil && n > 0 {
+			slog.Info("Expired idempotency keys purged", slog.Int64("count", n))
+		}
 		return err
+	})
+	auth := service.NewAuth(dal, service.AuthConfig{Lockout: service.LockoutConfig{Window: cfg.AuthLockoutWindow}})
+	runEvery(jobsCtx, &jobs, loginFailurePurgeInterval, "purge login failures", func(ctx context.Context) error {
+		n, err := auth.PurgeLoginFailures(ctx)
+		if err == nil && n > 0 {
+			slog.Info("Stale login failures purged", slog.Int64("count", n))
+		}
+		return err
+	})
+	if cfg.ReconcileAt >= 0 {
+		ledger := service.NewLedger(dal)
+		runDaily(jobsCtx, &jobs, cfg.ReconcileAt, "reconcile balances", func(ctx context.Context, slot time.Time) error {
+			report, err := ledger.ReconcileScheduled(ctx, slot, cfg.ReconcileFreeze)
+			if err != nil || report == nil {
+				return err
+			}
+			if len(report.Mismatches) > 0 {
+				slog.Warn("Balance mismatches found", slog.Int("count", len(report.Mismatches)), slog.Any("report", report))
+			}
+			return nil
+		})
 	}
-	defer dal.DBPool.Close()
 
-	r := routes.NewRouter(dal)
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           routes.NewRouter(dal, cfg, tokens),
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+	}
 
-	slog.Info("Starting server", slog.String("address", cfg.Port))
-	err = http.ListenAndServe(":"+cfg.Port, r)
-	if err != nil {
+	if cfg.LegacyGetBuy {
+		slog.Warn("GET /api/buy/{item} is deprecated and will be disabled by default in the next release; set API_LEGACY_GET_BUY=false to turn it off now")
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Starting server", slog.String("address", cfg.Port))
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serveErr:
 		slog.Error("Failed to start server", slog.String("error", err.Error()))
 		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down server", slog.Duration("timeout", cfg.ShutdownTimeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err = srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to drain connections", slog.String("error", err.Error()))
+		srv.Close()
+		return fmt.Errorf("failed to shutdown server: %w", err)
+	}
+	if err = <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	slog.Info("Server stopped")
+	return nil
+}
+
+func newStorage(ctx context.Context, cfg *config.Config) (db.Storage, error) {
+	switch cfg.Storage {
+	case config.StorageMemory:
+		slog.Warn("Using in-memory storage, data will be lost on restart")
+		return memory.New(), nil
+	case config.StoragePostgres, "":
+		dal, err := db.New(ctx, cfg.DSN())
+		if err != nil {
+			return nil, err
+		}
+		if cfg.AutoMigrate {
+			if err := migrateUp(ctx, dal); err != nil {
+				dal.Close()
+				return nil, err
+			}
+		}
+		return dal, nil
+	default:
+		return nil, fmt.Errorf("unknown storage %q", cfg.Storage)
+	}
+}
+
+func migrateUp(ctx context.Context, dal *db.DB) error {
+	m, err := migrate.New(dal.DBPool, migrations.FS)
+	if err != nil {
+		return err
+	}
+	applied, err := m.Up(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
 	}
+	slog.Info("Database schema is up to date", slog.Int("applied", len(applied)))
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/titoffon/merch-store/internal/db"
+)
+
+// Info - баланс, инвентарь и история монет пользователя, включая возвраты
+// за отменённые заказы.
+type Info struct {
+	Balance   int64
+	Inventory []db.PurchaseCount
+	Received  []db.ReceivedTransaction
+	Sent      []db.SentTransaction
+	Refunds   []db.Refund
+}
+
+// Account отдаёт сведения о пользователе.
+type Account struct {
+	store db.Storage
+}
+
+func NewAccount(store db.Storage) *Account {
+	return &Account{store: store}
+}
+
+func (a *Account) Info(ctx context.Context, username string) (*Info, error) {
+	user, err := a.store.GetUserByName(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by name: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	purchases, err := a.store.GetUserPurchases(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user purchases: %w", err)
+	}
+
+	received, err := a.store.GetTransactionsReceived(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get received transactions: %w", err)
+	}
+
+	sent, err := a.store.GetTransactionsSent(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sent transactions: %w", err)
+	}
+
+	refunds, err := a.store.GetUserRefunds(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refunds: %w", err)
+	}
+
+	return &Info{
+		Balance:   user.Balance,
+		Inventory: purchases,
+		Received:  received,
+		Sent:      sent,
+		Refunds:   refunds,
+	}, nil
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/titoffon/merch-store/internal/db"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// WelcomCoins начисляются каждому новому пользователю.
+const WelcomCoins = 1000
+
+// refreshTokenBytes - длина случайной части refresh-токена.
+const refreshTokenBytes = 32
+
+type AuthConfig struct {
+	// RefreshTTL - время жизни refresh-токена.
+	RefreshTTL time.Duration
+	// AutoRegister включает старое поведение: вход с неизвестным именем
+	// создаёт пользователя. Без него аккаунт заводится только через Register.
+	AutoRegister bool
+	// PasswordMinLength - минимальная длина пароля при регистрации.
+	// Ноль означает DefaultPasswordMinLength.
+	PasswordMinLength int
+	Lockout           LockoutConfig
+}
+
+// Auth регистрирует пользователей, проверяет учётные данные и ведёт
+// refresh-токены.
+type Auth struct {
+	store db.Storage
+	cfg   AuthConfig
+	now   func() time.Time
+}
+
+func NewAuth(store db.Storage, cfg AuthConfig) *Auth {
+	return &Auth{store: store, cfg: cfg, now: time.Now}
+}
+
+// Register создаёт пользователя с WelcomCoins на счету. Имя и пароль
+// должны проходить ValidateUsername и ValidatePassword.
+func (a *Auth) Register(ctx context.Context, username, password string) (*db.User, error) {
+	if username == "" || password == "" {
+		return nil, ErrEmptyCredentials
+	}
+	if err := ValidateUsername(username); err != nil {
+		return nil, err
+	}
+	if err := ValidatePassword(password, a.passwordMinLength()); err != nil {
+		return nil, err
+	}
+
+	existing, err := a.store.GetUserByName(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by name: %w", err)
+	}
+	if existing != nil {
+		return nil, ErrUserExists
+	}
+
+	user, err := a.createUser(ctx, username, password)
+	if errors.Is(err, db.ErrUserExists) {
+		return nil, ErrUserExists
+	}
+	return user, err
+}
+
+// Login возвращает пользователя, если пароль верный. Неизвестное имя
+// создаёт пользователя только при AutoRegister, иначе это такая же ошибка,
+// как неверный пароль. ip - адрес клиента для счётчика неудач, может быть
+// пустым. Пока вход заблокирован, возвращается *LockedError.
+func (a *Auth) Login(ctx context.Context, username, password, ip string) (*db.User, error) {
+	if username == "" || password == "" {
+		return nil, ErrEmptyCredentials
+	}
+
+	keys := a.lockKeys(username, ip)
+	hasFailures, err := a.checkLock(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := a.login(ctx, username, password)
+	switch {
+	case errors.Is(err, ErrInvalidCredentials):
+		if recordErr := a.recordFailure(ctx, keys); recordErr != nil {
+			return nil, recordErr
+		}
+		return nil, err
+	case err != nil:
+		return nil, err
+	}
+
+	if hasFailures {
+		if err := a.store.ResetLoginFailures(ctx, userLockKey(username)); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+func (a *Auth) login(ctx context.Context, username, password string) (*db.User, error) {
+	user, err := a.store.GetUserByName(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by name: %w", err)
+	}
+
+	if user == nil {
+		if !a.cfg.AutoRegister {
+			// Сравниваем с заглушкой, чтобы по времени ответа нельзя было
+			// отличить несуществующего пользователя от неверного пароля.
+			CheckPassword(string(dummyHash()), password)
+			return nil, ErrInvalidCredentials
+		}
+
+		user, err = a.createUser(ctx, username, password)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, db.ErrUserExists) {
+			return nil, err
+		}
+		// Пользователя только что создал параллельный вход - проверяем
+		// пароль как у существующего.
+		user, err = a.store.GetUserByName(ctx, username)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user by name: %w", err)
+		}
+		if user == nil {
+			return nil, ErrInvalidCredentials
+		}
+	}
+
+	valid, err := CheckPassword(user.HashedPassword, password)
+	if err != nil || !valid {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+func (a *Auth) createUser(ctx context.Context, username, password string) (*db.User, error) {
+	hashPassword, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := a.store.CreateUser(ctx, db.User{
+		Username:       username,
+		HashedPassword: string(hashPassword),
+		Balance:        WelcomCoins,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return user, nil
+}
+
+func (a *Auth) passwordMinLength() int {
+	if a.cfg.PasswordMinLength > 0 {
+		return a.cfg.PasswordMinLength
+	}
+	return DefaultPasswordMinLength
+}
+
+// IssueRefreshToken выдаёт новый refresh-токен, открывающий новую цепочку ротаций.
+func (a *Auth) IssueRefreshToken(ctx context.Context, username string) (string, error) {
+	familyID, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	raw, token, err := a.newRefreshToken(username, familyID)
+	if err != nil {
+		return "", err
+	}
+
+	err = a.store.InTx(ctx, func(tx db.Tx) error {
+		return tx.InsertRefreshToken(ctx, token)
+	})
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// Refresh обменивает действующий refresh-токен на новый и возвращает
+// владельца с его текущими ролями. Старый токен отзывается. Предъявление
+// уже заменённого токена считается утечкой: отзывается вся цепочка.
+func (a *Auth) Refresh(ctx context.Context, raw string) (*db.User, string, error) {
+	username, newRaw, err := a.rotate(ctx, raw)
+	if err != nil {
+		return nil, "", err
+	}
+	user, err := a.store.GetUserByName(ctx, username)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get user by name: %w", err)
+	}
+	if user == nil {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	return user, newRaw, nil
+}
+
+func (a *Auth) rotate(ctx context.Context, raw string) (string, string, error) {
+	if raw == "" {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	current, err := a.store.GetRefreshToken(ctx, hashToken(raw))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	if current == nil {
+		return "", "", ErrInvalidRefreshToken
+	}
+	if current.RevokedAt != nil {
+		if current.ReplacedBy != "" {
+			slog.Warn("Refresh token reuse detected, revoking the family", slog.String("username", current.Username))
+			if err := a.store.RevokeRefreshTokenFamily(ctx, current.FamilyID); err != nil {
+				return "", "", err
+			}
+		}
+		return "", "", ErrInvalidRefreshToken
+	}
+	if !a.now().Before(current.ExpiresAt) {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	newRaw, next, err := a.newRefreshToken(current.Username, current.FamilyID)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = a.store.InTx(ctx, func(tx db.Tx) error {
+		revoked, err := tx.RevokeRefreshToken(ctx, current.TokenHash, next.TokenHash)
+		if err != nil {
+			return err
+		}
+		if !revoked {
+			// Токен успели ротировать параллельным запросом.
+			return ErrInvalidRefreshToken
+		}
+		return tx.InsertRefreshToken(ctx, next)
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return current.Username, newRaw, nil
+}
+
+// RevokeRefreshToken отзывает цепочку, к которой относится токен.
+// Неизвестные токены игнорируются.
+func (a *Auth) RevokeRefreshToken(ctx context.Context, raw string) error {
+	if raw == "" {
+		return ErrInvalidRefreshToken
+	}
+	current, err := a.store.GetRefreshToken(ctx, hashToken(raw))
+	if err != nil {
+		return fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	if current == nil {
+		return nil
+	}
+	return a.store.RevokeRefreshTokenFamily(ctx, current.FamilyID)
+}
+
+func (a *Auth) newRefreshToken(username, familyID string) (string, db.RefreshToken, error) {
+	raw, err := randomToken()
+	if err != nil {
+		return "", db.RefreshToken{}, err
+	}
+	return raw, db.RefreshToken{
+		TokenHash: hashToken(raw),
+		Username:  username,
+		FamilyID:  familyID,
+		ExpiresAt: a.now().Add(a.cfg.RefreshTTL),
+	}, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func CheckPassword(hashPassword, password string) (bool, error) {
+
+	err := bcrypt.CompareHashAndPassword([]byte(hashPassword), []byte(password))
+	if err != nil {
+		slog.Info("The password is uncorrect")
+		return false, nil
+	}
+	slog.Info("The password is correct")
+	return true, nil
+}
+
+func HashPassword(password string) ([]byte, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	return hashedPassword, nil
+}
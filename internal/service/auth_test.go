@@ -0,0 +1,408 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/titoffon/merch-store/internal/db"
+	"github.com/titoffon/merch-store/internal/db/memory"
+	"github.com/titoffon/merch-store/internal/rbac"
+	"github.com/titoffon/merch-store/internal/service"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthLogin(t *testing.T) {
+	ctx := context.Background()
+	auth := service.NewAuth(memory.New(), service.AuthConfig{RefreshTTL: time.Hour, AutoRegister: true})
+
+	user, err := auth.Login(ctx, "newbie", "secret", "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if user.Balance != service.WelcomCoins {
+		t.Errorf("expected welcome balance %d, got %d", service.WelcomCoins, user.Balance)
+	}
+
+	if _, err := auth.Login(ctx, "newbie", "secret", ""); err != nil {
+		t.Errorf("expected existing user to log in, got %v", err)
+	}
+	if _, err := auth.Login(ctx, "newbie", "wrong", ""); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials, got %v", err)
+	}
+	if _, err := auth.Login(ctx, "", "secret", ""); !errors.Is(err, service.ErrEmptyCredentials) {
+		t.Errorf("expected ErrEmptyCredentials, got %v", err)
+	}
+}
+
+// staleStore отдаёт первым n вызовам GetUserByName "пользователя нет" только
+// после того, как все n до него дошли, - так все входы гарантированно
+// пытаются создать пользователя одновременно.
+type staleStore struct {
+	*memory.Store
+	arrived sync.WaitGroup
+	stale   atomic.Int32
+	created atomic.Int32
+}
+
+func newStaleStore(n int) *staleStore {
+	s := &staleStore{Store: memory.New()}
+	s.arrived.Add(n)
+	s.stale.Store(int32(n))
+	return s
+}
+
+func (s *staleStore) GetUserByName(ctx context.Context, name string) (*db.User, error) {
+	if s.stale.Add(-1) >= 0 {
+		s.arrived.Done()
+		s.arrived.Wait()
+		return nil, nil
+	}
+	return s.Store.GetUserByName(ctx, name)
+}
+
+func (s *staleStore) CreateUser(ctx context.Context, user db.User) (*db.User, error) {
+	created, err := s.Store.CreateUser(ctx, user)
+	if err == nil {
+		s.created.Add(1)
+	}
+	return created, err
+}
+
+func TestAuthConcurrentFirstLogin(t *testing.T) {
+	const n = 8
+	ctx := context.Background()
+	store := newStaleStore(n)
+	auth := service.NewAuth(store, service.AuthConfig{RefreshTTL: time.Hour, AutoRegister: true})
+
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := auth.Login(ctx, "racer", "secret", "")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("expected every concurrent first login to succeed, got %v", err)
+		}
+	}
+	if created := store.created.Load(); created != 1 {
+		t.Errorf("expected exactly one user to be created, got %d", created)
+	}
+
+	if _, err := auth.Login(ctx, "racer", "wrong", ""); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials, got %v", err)
+	}
+}
+
+func TestAuthRegister(t *testing.T) {
+	ctx := context.Background()
+	auth := service.NewAuth(memory.New(), service.AuthConfig{RefreshTTL: time.Hour})
+
+	if _, err := auth.Login(ctx, "typo", "secret123", ""); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Errorf("expected strict login to reject unknown user, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		err      error
+	}{
+		{name: "empty", username: "", password: "secret123", err: service.ErrEmptyCredentials},
+		{name: "short username", username: "ab", password: "secret123", err: service.ErrInvalidUsername},
+		{name: "bad characters", username: "bob smith", password: "secret123", err: service.ErrInvalidUsername},
+		{name: "short password", username: "bob", password: "s3cret", err: service.ErrWeakPassword},
+		{name: "no digit", username: "bob", password: "secretsecret", err: service.ErrWeakPassword},
+		{name: "no letter", username: "bob", password: "12345678", err: service.ErrWeakPassword},
+		{name: "success", username: "bob", password: "secret123"},
+		{name: "duplicate", username: "bob", password: "secret123", err: service.ErrUserExists},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			user, err := auth.Register(ctx, tc.username, tc.password)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if tc.err == nil && user.Balance != service.WelcomCoins {
+				t.Errorf("expected welcome balance %d, got %d", service.WelcomCoins, user.Balance)
+			}
+		})
+	}
+
+	if _, err := auth.Login(ctx, "bob", "secret123", ""); err != nil {
+		t.Errorf("expected registered user to log in, got %v", err)
+	}
+}
+
+func TestAuthRefresh(t *testing.T) {
+	ctx := context.Background()
+	auth := service.NewAuth(memory.New(), service.AuthConfig{RefreshTTL: time.Hour, AutoRegister: true})
+
+	if _, err := auth.Login(ctx, "erin", "secret", ""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	first, err := auth.IssueRefreshToken(ctx, "erin")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	user, second, err := auth.Refresh(ctx, first)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if user.Username != "erin" || second == "" || second == first {
+		t.Fatalf("unexpected rotation result: username=%q token=%q", user.Username, second)
+	}
+
+	if _, _, err := auth.Refresh(ctx, first); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Errorf("expected ErrInvalidRefreshToken for reused token, got %v", err)
+	}
+	if _, _, err := auth.Refresh(ctx, second); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Errorf("expected the whole family to be revoked after reuse, got %v", err)
+	}
+	if _, _, err := auth.Refresh(ctx, "unknown"); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Errorf("expected ErrInvalidRefreshToken for unknown token, got %v", err)
+	}
+}
+
+func TestAuthRefreshExpired(t *testing.T) {
+	ctx := context.Background()
+	auth := service.NewAuth(memory.New(), service.AuthConfig{RefreshTTL: -time.Second, AutoRegister: true})
+
+	if _, err := auth.Login(ctx, "frank", "secret", ""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	token, err := auth.IssueRefreshToken(ctx, "frank")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, _, err := auth.Refresh(ctx, token); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Errorf("expected ErrInvalidRefreshToken for expired token, got %v", err)
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte("test123"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatalf("failed to generate hash: %v", err)
+	}
+
+	ok, err := service.CheckPassword(string(hashed), "test123")
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if !ok {
+		t.Errorf("expected password to match, got false")
+	}
+
+	ok, err = service.CheckPassword(string(hashed), "wrongPass")
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if ok {
+		t.Errorf("expected password mismatch (false), got true")
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	password := "mySecretPassword"
+
+	hashed, err := service.HashPassword(password)
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if len(hashed) == 0 {
+		t.Error("expected non-empty hashed password")
+	}
+
+	if err := bcrypt.CompareHashAndPassword(hashed, []byte(password)); err != nil {
+		t.Errorf("bcrypt.CompareHashAndPassword should succeed for the correct password, got err=%v", err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword(hashed, []byte("wrong")); err == nil {
+		t.Error("expected error for wrong password, got nil")
+	}
+}
+
+func TestAuthLockout(t *testing.T) {
+	ctx := context.Background()
+	auth := service.NewAuth(memory.New(), service.AuthConfig{
+		RefreshTTL:   time.Hour,
+		AutoRegister: true,
+		Lockout: service.LockoutConfig{
+			Threshold:   3,
+			IPThreshold: 5,
+			BaseDelay:   time.Minute,
+			MaxDelay:    3 * time.Minute,
+			Window:      time.Hour,
+		},
+	})
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	service.SetNow(auth, func() time.Time { return now })
+
+	if _, err := auth.Login(ctx, "grace", "secret", "10.0.0.1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := auth.Login(ctx, "grace", "wrong", "10.0.0.1"); !errors.Is(err, service.ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: expected ErrInvalidCredentials, got %v", i+1, err)
+		}
+	}
+
+	_, err := auth.Login(ctx, "grace", "secret", "10.0.0.2")
+	var locked *service.LockedError
+	if !errors.As(err, &locked) || !errors.Is(err, service.ErrTooManyAttempts) {
+		t.Fatalf("expected LockedError even with the right password, got %v", err)
+	}
+	if locked.RetryAfter != time.Minute {
+		t.Errorf("expected retry after 1m, got %s", locked.RetryAfter)
+	}
+
+	// Каждая следующая неудача удваивает блокировку, но не больше MaxDelay.
+	for _, want := range []time.Duration{2 * time.Minute, 3 * time.Minute} {
+		now = now.Add(locked.RetryAfter)
+		if _, err := auth.Login(ctx, "grace", "wrong", "10.0.0.3"); !errors.Is(err, service.ErrInvalidCredentials) {
+			t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+		}
+		_, err = auth.Login(ctx, "grace", "secret", "10.0.0.3")
+		if !errors.As(err, &locked) || locked.RetryAfter != want {
+			t.Fatalf("expected lock for %s, got %v", want, err)
+		}
+	}
+
+	if err := auth.Unlock(ctx, ""); !errors.Is(err, service.ErrInvalidUsername) {
+		t.Errorf("expected ErrInvalidUsername, got %v", err)
+	}
+	if err := auth.Unlock(ctx, "ghost"); !errors.Is(err, service.ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+	if err := auth.Unlock(ctx, "grace"); err != nil {
+		t.Fatalf("failed to unlock: %v", err)
+	}
+	if _, err := auth.Login(ctx, "grace", "secret", "10.0.0.4"); err != nil {
+		t.Fatalf("expected login after unlock, got %v", err)
+	}
+	// Успешный вход сбросил счётчик: одна неудача не блокирует.
+	if _, err := auth.Login(ctx, "grace", "wrong", "10.0.0.4"); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+	if _, err := auth.Login(ctx, "grace", "secret", "10.0.0.4"); err != nil {
+		t.Errorf("expected counter to be reset after success, got %v", err)
+	}
+}
+
+func TestAuthLockoutByIP(t *testing.T) {
+	ctx := context.Background()
+	auth := service.NewAuth(memory.New(), service.AuthConfig{
+		RefreshTTL:   time.Hour,
+		AutoRegister: true,
+		Lockout: service.LockoutConfig{
+			Threshold:   10,
+			IPThreshold: 2,
+			BaseDelay:   time.Minute,
+			MaxDelay:    time.Hour,
+			Window:      time.Hour,
+		},
+	})
+
+	for _, name := range []string{"heidi", "ivan"} {
+		if _, err := auth.Login(ctx, name, "secret", ""); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := auth.Login(ctx, name, "wrong", "10.0.0.9"); !errors.Is(err, service.ErrInvalidCredentials) {
+			t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+		}
+	}
+
+	if _, err := auth.Login(ctx, "heidi", "secret", "10.0.0.9"); !errors.Is(err, service.ErrTooManyAttempts) {
+		t.Errorf("expected address to be locked, got %v", err)
+	}
+	if _, err := auth.Login(ctx, "heidi", "secret", "10.0.0.10"); err != nil {
+		t.Errorf("expected other addresses to log in, got %v", err)
+	}
+}
+
+func TestAuthPurgeLoginFailures(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	auth := service.NewAuth(store, service.AuthConfig{
+		RefreshTTL: time.Hour,
+		Lockout: service.LockoutConfig{
+			Threshold: 2,
+			BaseDelay: 3 * time.Hour,
+			MaxDelay:  3 * time.Hour,
+			Window:    time.Hour,
+		},
+	})
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	service.SetNow(auth, func() time.Time { return now })
+
+	// В строгом режиме неудачи копятся и под несуществующими именами.
+	for _, name := range []string{"ghost", "locked", "locked"} {
+		if _, err := auth.Login(ctx, name, "wrong", ""); !errors.Is(err, service.ErrInvalidCredentials) {
+			t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+		}
+	}
+
+	if n, err := auth.PurgeLoginFailures(ctx); err != nil || n != 0 {
+		t.Fatalf("expected nothing to purge inside the window, got %d, %v", n, err)
+	}
+
+	// Через два часа счётчик ghost устарел, а locked ещё держит блокировку.
+	now = now.Add(2 * time.Hour)
+	if n, err := auth.PurgeLoginFailures(ctx); err != nil || n != 1 {
+		t.Fatalf("expected 1 purged counter, got %d, %v", n, err)
+	}
+	if lf, _ := store.GetLoginFailure(ctx, "user:locked"); lf == nil {
+		t.Error("expected the active lock to survive the purge")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if n, err := auth.PurgeLoginFailures(ctx); err != nil || n != 1 {
+		t.Fatalf("expected the expired lock to be purged, got %d, %v", n, err)
+	}
+}
+
+func TestAuthRoles(t *testing.T) {
+	ctx := context.Background()
+	auth := service.NewAuth(memory.New(), service.AuthConfig{RefreshTTL: time.Hour, AutoRegister: true})
+
+	if err := auth.GrantRole(ctx, "ghost", rbac.RoleAdmin); !errors.Is(err, service.ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+	if _, err := auth.Login(ctx, "karl", "secret", ""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := auth.SetRoles(ctx, "karl", []string{"root"}); !errors.Is(err, service.ErrUnknownRole) {
+		t.Errorf("expected ErrUnknownRole, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := auth.GrantRole(ctx, "karl", rbac.RoleAdmin); err != nil {
+			t.Fatalf("failed to grant role: %v", err)
+		}
+	}
+	refresh, err := auth.IssueRefreshToken(ctx, "karl")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	user, _, err := auth.Refresh(ctx, refresh)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(user.Roles) != 1 || user.Roles[0] != rbac.RoleAdmin {
+		t.Errorf("expected roles [admin] after refresh, got %v", user.Roles)
+	}
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/titoffon/merch-store/internal/db"
+)
+
+const (
+	ItemNameMaxLength    = 64
+	ItemMaxPrice         = 1_000_000
+	itemDescriptionLimit = 2000
+	itemCategoryLimit    = 64
+	itemImageURLLimit    = 2048
+)
+
+// Действия администраторов в журнале аудита.
+const (
+	AuditMerchCreate  = "merch.create"
+	AuditMerchUpdate  = "merch.update"
+	AuditMerchArchive = "merch.archive"
+	AuditMerchRestock = "merch.restock"
+	AuditMerchStock   = "merch.stock"
+)
+
+// ItemPatch - изменение карточки товара. Поля со значением nil не меняются.
+type ItemPatch struct {
+	Price       *int64
+	Description *string
+	Category    *string
+	ImageURL    *string
+	Active      *bool
+}
+
+// Catalog ведёт каталог мерча. Каждое изменение пишется в журнал аудита
+// в той же транзакции.
+type Catalog struct {
+	store db.Storage
+}
+
+func NewCatalog(store db.Storage) *Catalog {
+	return &Catalog{store: store}
+}
+
+func (c *Catalog) List(ctx context.Context, filter db.MerchFilter) ([]db.MerchItem, error) {
+	if !db.ValidMerchSort(filter.Sort) {
+		return nil, fmt.Errorf("%w: unknown sort %q", ErrInvalidFilter, filter.Sort)
+	}
+	if filter.MinPrice < 0 || filter.MaxPrice < 0 {
+		return nil, fmt.Errorf("%w: price bounds must not be negative", ErrInvalidFilter)
+	}
+	if filter.MaxPrice != 0 && filter.MinPrice > filter.MaxPrice {
+		return nil, fmt.Errorf("%w: minPrice is greater than maxPrice", ErrInvalidFilter)
+	}
+	return c.store.ListMerchItems(ctx, filter)
+}
+
+// Item возвращает товар, в том числе снятый с продажи.
+func (c *Catalog) Item(ctx context.Context, name string) (*db.MerchItem, error) {
+	item, err := c.store.GetMerchItem(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrItemNotFound
+	}
+	return item, nil
+}
+
+// Create добавляет товар от имени администратора actor.
+func (c *Catalog) Create(ctx context.Context, actor string, item db.MerchItem) (*db.MerchItem, error) {
+	if err := ValidateItem(item); err != nil {
+		return nil, err
+	}
+
+	err := c.store.InTx(ctx, func(tx db.Tx) error {
+		if err := tx.InsertMerchItem(ctx, item); err != nil {
+			if errors.Is(err, db.ErrItemExists) {
+				return ErrItemExists
+			}
+			return err
+		}
+		return auditMerch(ctx, tx, actor, AuditMerchCreate, item.Name, nil, &item)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Merch item created", slog.String("item", item.Name), slog.String("actor", actor))
+	return &item, nil
+}
+
+// Update применяет patch к товару name. Снятый с продажи товар можно вернуть,
+// передав Active = true.
+func (c *Catalog) Update(ctx context.Context, actor, name string, patch ItemPatch) (*db.MerchItem, error) {
+	action := AuditMerchUpdate
+	if patch.Active != nil && !*patch.Active {
+		action = AuditMerchArchive
+	}
+	return c.update(ctx, actor, name, action, func(item *db.MerchItem) {
+		if patch.Price != nil {
+			item.Price = *patch.Price
+		}
+		if patch.Description != nil {
+			item.Description = *patch.Description
+		}
+		if patch.Category != nil {
+			item.Category = *patch.Category
+		}
+		if patch.ImageURL != nil {
+			item.ImageURL = *patch.ImageURL
+		}
+		if patch.Active != nil {
+			item.Active = *patch.Active
+		}
+	})
+}
+
+// Archive снимает товар с продажи. Купить его больше нельзя, но покупки
+// остаются в истории.
+func (c *Catalog) Archive(ctx context.Context, actor, name string) (*db.MerchItem, error) {
+	return c.update(ctx, actor, name, AuditMerchArchive, func(item *db.MerchItem) {
+		item.Active = false
+	})
+}
+
+// Restock добавляет quantity единиц на склад. Для товара без учёта остатка
+// возвращает ErrUnlimitedStock.
+func (c *Catalog) Restock(ctx context.Context, actor, name string, quantity int64) (*db.MerchItem, error) {
+	if quantity <= 0 {
+		return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidItem)
+	}
+	return c.changeStock(ctx, actor, name, AuditMerchRestock, func(tx db.Tx, item *db.MerchItem) error {
+		stock, err := tx.AddMerchStock(ctx, name, quantity)
+		if err != nil {
+			if errors.Is(err, db.ErrUnlimitedStock) {
+				return ErrUnlimitedStock
+			}
+			return err
+		}
+		item.Stock = &stock
+		return nil
+	})
+}
+
+// SetStock задаёт остаток по итогам инвентаризации; nil снимает ограничение.
+func (c *Catalog) SetStock(ctx context.Context, actor, name string, stock *int64) (*db.MerchItem, error) {
+	if stock != nil && *stock < 0 {
+		return nil, fmt.Errorf("%w: stock must not be negative", ErrInvalidItem)
+	}
+	return c.changeStock(ctx, actor, name, AuditMerchStock, func(tx db.Tx, item *db.MerchItem) error {
+		if err := tx.SetMerchStock(ctx, name, stock); err != nil {
+			return err
+		}
+		item.Stock = stock
+		return nil
+	})
+}
+
+// History возвращает последние limit записей аудита по товару.
+func (c *Catalog) History(ctx context.Context, name string, limit int) ([]db.AuditEntry, error) {
+	return c.store.ListAuditEntries(ctx, merchAuditTarget(name), limit)
+}
+
+func (c *Catalog) update(ctx context.Context, actor, name, action string, apply func(item *db.MerchItem)) (*db.MerchItem, error) {
+	var after db.MerchItem
+	var changed bool
+	err := c.store.InTx(ctx, func(tx db.Tx) error {
+		before, err := tx.GetMerchItemForUpdate(ctx, name)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return ErrItemNotFound
+		}
+
+		after = *before
+		apply(&after)
+		if err := ValidateItem(after); err != nil {
+			return err
+		}
+		if changed = after != *before; !changed {
+			return nil
+		}
+
+		if err := tx.UpdateMerchItem(ctx, after); err != nil {
+			return err
+		}
+		return auditMerch(ctx, tx, actor, action, name, before, &after)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if changed {
+		slog.Info("Merch item updated", slog.String("item", name), slog.String("action", action), slog.String("actor", actor))
+	}
+	return &after, nil
+}
+
+func (c *Catalog) changeStock(ctx context.Context, actor, name, action string, change func(tx db.Tx, item *db.MerchItem) error) (*db.MerchItem, error) {
+	var after db.MerchItem
+	err := c.store.InTx(ctx, func(tx db.Tx) error {
+		before, err := tx.GetMerchItemForUpdate(ctx, name)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return ErrItemNotFound
+		}
+
+		after = *before
+		if err := change(tx, &after); err != nil {
+			return err
+		}
+		return auditMerch(ctx, tx, actor, action, name, before, &after)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Merch stock changed", slog.String("item", name), slog.String("action", action), slog.String("actor", actor))
+	return &after, nil
+}
+
+// ValidateItem проверяет карточку товара перед сохранением.
+func ValidateItem(item db.MerchItem) error {
+	if item.Name == "" || len(item.Name) > ItemNameMaxLength {
+		return fmt.Errorf("%w: name must be 1 to %d characters long", ErrInvalidItem, ItemNameMaxLength)
+	}
+	for i, r := range item.Name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && (r != '-' || i == 0) {
+			return fmt.Errorf("%w: name may contain only lowercase latin letters, digits and '-'", ErrInvalidItem)
+		}
+	}
+	if item.Price <= 0 || item.Price > ItemMaxPrice {
+		return fmt.Errorf("%w: price must be between 1 and %d", ErrInvalidItem, ItemMaxPrice)
+	}
+	if item.Stock != nil && *item.Stock < 0 {
+		return fmt.Errorf("%w: stock must not be negative", ErrInvalidItem)
+	}
+	if utf8.RuneCountInString(item.Description) > itemDescriptionLimit {
+		return fmt.Errorf("%w: description must be at most %d characters long", ErrInvalidItem, itemDescriptionLimit)
+	}
+	if utf8.RuneCountInString(item.Category) > itemCategoryLimit {
+		return fmt.Errorf("%w: category must be at most %d characters long", ErrInvalidItem, itemCategoryLimit)
+	}
+	if item.ImageURL != "" {
+		u, err := url.Parse(item.ImageURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(item.ImageURL) > itemImageURLLimit {
+			return fmt.Errorf("%w: image URL must be an absolute http(s) URL", ErrInvalidItem)
+		}
+	}
+	return nil
+}
+
+func merchAuditTarget(name string) string {
+	return "merch:" + name
+}
+
+// itemSnapshot - состояние товара в журнале аудита.
+type itemSnapshot struct {
+	Price       int64  `json:"price"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	ImageURL    string `json:"imageUrl"`
+	Active      bool   `json:"active"`
+	Stock       *int64 `json:"stock"`
+}
+
+func snapshot(item *db.MerchItem) *itemSnapshot {
+	if item == nil {
+		return nil
+	}
+	return &itemSnapshot{
+		Price:       item.Price,
+		Description: item.Description,
+		Category:    item.Category,
+		ImageURL:    item.ImageURL,
+		Active:      item.Active,
+		Stock:       item.Stock,
+	}
+}
+
+func auditMerch(ctx context.Context, tx db.Tx, actor, action, name string, before, after *db.MerchItem) error {
+	details, err := json.Marshal(struct {
+		Before *itemSnapshot `json:"before,omitempty"`
+		After  *itemSnapshot `json:"after,omitempty"`
+	}{snapshot(before), snapshot(after)})
+	if err != nil {
+		return fmt.Errorf("failed to encode audit details: %w", err)
+	}
+	return tx.InsertAuditEntry(ctx, db.AuditEntry{
+		Actor:   actor,
+		Action:  action,
+		Target:  merchAuditTarget(name),
+		Details: details,
+	})
+}
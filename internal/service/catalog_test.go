@@ -0,0 +1,147 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/titoffon/merch-store/internal/db"
+	"github.com/titoffon/merch-store/internal/db/memory"
+	"github.com/titoffon/merch-store/internal/service"
+)
+
+func TestValidateItem(t *testing.T) {
+	valid := db.MerchItem{Name: "sticker-pack", Price: 15, ImageURL: "https://cdn.example.com/sticker.png"}
+
+	tests := []struct {
+		name   string
+		mutate func(item *db.MerchItem)
+		ok     bool
+	}{
+		{name: "valid", mutate: func(*db.MerchItem) {}, ok: true},
+		{name: "empty name", mutate: func(item *db.MerchItem) { item.Name = "" }},
+		{name: "uppercase name", mutate: func(item *db.MerchItem) { item.Name = "Sticker" }},
+		{name: "leading dash", mutate: func(item *db.MerchItem) { item.Name = "-sticker" }},
+		{name: "zero price", mutate: func(item *db.MerchItem) { item.Price = 0 }},
+		{name: "huge price", mutate: func(item *db.MerchItem) { item.Price = service.ItemMaxPrice + 1 }},
+		{name: "relative image URL", mutate: func(item *db.MerchItem) { item.ImageURL = "/img/sticker.png" }},
+		{name: "javascript image URL", mutate: func(item *db.MerchItem) { item.ImageURL = "javascript:alert(1)" }},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			item := valid
+			tc.mutate(&item)
+			err := service.ValidateItem(item)
+			if tc.ok && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if !tc.ok && !errors.Is(err, service.ErrInvalidItem) {
+				t.Errorf("expected ErrInvalidItem, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	newUser(t, store, "buyer", 1000)
+	catalog := service.NewCatalog(store)
+	shop := service.NewShop(store, service.ShopConfig{})
+
+	sticker := db.MerchItem{Name: "sticker", Price: 5, Category: "office", Active: true}
+	if _, err := catalog.Create(ctx, "admin", sticker); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := catalog.Create(ctx, "admin", sticker); !errors.Is(err, service.ErrItemExists) {
+		t.Errorf("expected ErrItemExists, got %v", err)
+	}
+	if err := shop.Buy(ctx, "buyer", "sticker"); err != nil {
+		t.Fatalf("expected new item to be on sale, got %v", err)
+	}
+
+	price := int64(7)
+	updated, err := catalog.Update(ctx, "admin", "sticker", service.ItemPatch{Price: &price})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if updated.Price != 7 || updated.Category != "office" {
+		t.Errorf("expected only price to change, got %+v", updated)
+	}
+	zero := int64(0)
+	if _, err := catalog.Update(ctx, "admin", "sticker", service.ItemPatch{Price: &zero}); !errors.Is(err, service.ErrInvalidItem) {
+		t.Errorf("expected ErrInvalidItem, got %v", err)
+	}
+	if _, err := catalog.Update(ctx, "admin", "ghost", service.ItemPatch{Price: &price}); !errors.Is(err, service.ErrItemNotFound) {
+		t.Errorf("expected ErrItemNotFound, got %v", err)
+	}
+
+	if _, err := catalog.Archive(ctx, "admin", "sticker"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := shop.Buy(ctx, "buyer", "sticker"); !errors.Is(err, service.ErrItemNotFound) {
+		t.Errorf("expected archived item not to be sold, got %v", err)
+	}
+	active, _ := catalog.List(ctx, db.MerchFilter{})
+	all, _ := catalog.List(ctx, db.MerchFilter{IncludeArchived: true})
+	if len(all) != len(active)+1 {
+		t.Errorf("expected archived item only in the full list, got %d and %d items", len(active), len(all))
+	}
+
+	history, err := catalog.History(ctx, "sticker", 10)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var actions []string
+	for _, e := range history {
+		actions = append(actions, e.Action)
+		if e.Actor != "admin" || !json.Valid(e.Details) {
+			t.Errorf("unexpected audit entry: %+v", e)
+		}
+	}
+	want := []string{service.AuditMerchArchive, service.AuditMerchUpdate, service.AuditMerchCreate}
+	if len(actions) != len(want) {
+		t.Fatalf("expected actions %v, got %v", want, actions)
+	}
+	for i := range want {
+		if actions[i] != want[i] {
+			t.Errorf("expected actions %v, got %v", want, actions)
+			break
+		}
+	}
+}
+
+func TestCatalogListFilter(t *testing.T) {
+	ctx := context.Background()
+	catalog := service.NewCatalog(memory.New())
+
+	items, err := catalog.List(ctx, db.MerchFilter{MinPrice: 50, MaxPrice: 200, Sort: db.MerchSortPriceDesc})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var names []string
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	want := []string{"powerbank", "umbrella", "t-shirt", "book", "wallet"}
+	if len(names) != len(want) {
+		t.Fatalf("expected %v, got %v", want, names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, names)
+		}
+	}
+
+	for _, filter := range []db.MerchFilter{
+		{Sort: "popularity"},
+		{MinPrice: -1},
+		{MinPrice: 100, MaxPrice: 10},
+	} {
+		if _, err := catalog.List(ctx, filter); !errors.Is(err, service.ErrInvalidFilter) {
+			t.Errorf("expected ErrInvalidFilter for %+v, got %v", filter, err)
+		}
+	}
+}
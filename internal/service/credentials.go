@@ -0,0 +1,65 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	UsernameMinLength = 3
+	UsernameMaxLength = 32
+
+	DefaultPasswordMinLength = 8
+	// passwordMaxLength - bcrypt учитывает только первые 72 байта пароля.
+	passwordMaxLength = 72
+)
+
+// ValidateUsername допускает от UsernameMinLength до UsernameMaxLength
+// латинских букв, цифр и символов '.', '_', '-'.
+func ValidateUsername(username string) error {
+	if len(username) < UsernameMinLength || len(username) > UsernameMaxLength {
+		return fmt.Errorf("%w: must be %d to %d characters long", ErrInvalidUsername, UsernameMinLength, UsernameMaxLength)
+	}
+	for _, r := range username {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+		default:
+			return fmt.Errorf("%w: only latin letters, digits, '.', '_' and '-' are allowed", ErrInvalidUsername)
+		}
+	}
+	return nil
+}
+
+// ValidatePassword требует не меньше minLength символов, не больше 72 байт
+// и хотя бы одну букву и одну цифру.
+func ValidatePassword(password string, minLength int) error {
+	if len([]rune(password)) < minLength {
+		return fmt.Errorf("%w: must be at least %d characters long", ErrWeakPassword, minLength)
+	}
+	if len(password) > passwordMaxLength {
+		return fmt.Errorf("%w: must be at most %d bytes long", ErrWeakPassword, passwordMaxLength)
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return fmt.Errorf("%w: must contain a letter and a digit", ErrWeakPassword)
+	}
+	return nil
+}
+
+// dummyHash - хеш, с которым сравнивается пароль несуществующего пользователя.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("merch-store-dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
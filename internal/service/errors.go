@@ -0,0 +1,42 @@
+// Package service содержит бизнес-правила магазина: покупку мерча, переводы
+// монет, сведения о пользователе и вход. Пакет не знает про HTTP и JWT,
+// поэтому его можно переиспользовать из CLI, gRPC или фоновых задач.
+package service
+
+import "errors"
+
+var (
+	ErrEmptyCredentials    = errors.New("username and password must not be empty")
+	ErrInvalidCredentials  = errors.New("invalid username or password")
+	ErrUserExists          = errors.New("user already exists")
+	ErrInvalidUsername     = errors.New("invalid username")
+	ErrWeakPassword        = errors.New("password is too weak")
+	ErrTooManyAttempts     = errors.New("too many failed login attempts")
+	ErrUnknownRole         = errors.New("unknown role")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrItemNotFound        = errors.New("there is no such product")
+	ErrItemExists          = errors.New("item already exists")
+	ErrInvalidItem         = errors.New("invalid item")
+	ErrInvalidFilter       = errors.New("invalid filter")
+	ErrOutOfStock          = errors.New("item is out of stock")
+	ErrUnlimitedStock      = errors.New("item has unlimited stock")
+	ErrInsufficientFunds   = errors.New("not enough coins")
+	ErrBalanceMismatch     = errors.New("balance does not match the ledger")
+	ErrReconcileInProgress = errors.New("balance reconciliation is already running")
+	ErrAccountFrozen       = errors.New("account is frozen")
+	ErrInvalidOrder        = errors.New("invalid order")
+	ErrOrderNotFound       = errors.New("order not found")
+	ErrInvalidOrderStatus  = errors.New("unknown order status")
+	ErrOrderStatusConflict = errors.New("order status cannot be changed")
+	ErrCancelWindowExpired = errors.New("order can no longer be cancelled")
+	ErrInvalidTransfer     = errors.New("invalid user or amount")
+	ErrReceiverNotFound    = errors.New("receiver user does not exist")
+	ErrInvalidTransferNote = errors.New("invalid transfer message or category")
+	ErrInvalidReaction     = errors.New("unknown reaction")
+	ErrTransferNotFound    = errors.New("transfer not found")
+
+	ErrInvalidIdempotencyKey = errors.New("invalid idempotency key")
+	ErrIdempotencyKeyReused  = errors.New("idempotency key was used for a different request")
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key is in progress")
+)
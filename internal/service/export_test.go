@@ -0,0 +1,23 @@
+package service
+
+import "time"
+
+// SetNow подменяет часы Auth в тестах.
+func SetNow(a *Auth, now func() time.Time) {
+	a.now = now
+}
+
+// SetShopNow подменяет часы Shop в тестах.
+func SetShopNow(s *Shop, now func() time.Time) {
+	s.now = now
+}
+
+// SetIdempotencyNow подменяет часы Idempotency в тестах.
+func SetIdempotencyNow(i *Idempotency, now func() time.Time) {
+	i.now = now
+}
+
+// SetLedgerNow подменяет часы Ledger в тестах.
+func SetLedgerNow(l *Ledger, now func() time.Time) {
+	l.now = now
+}
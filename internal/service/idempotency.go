@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/titoffon/merch-store/internal/db"
+)
+
+// IdempotencyKeyMaxLength - предельная длина ключа идемпотентности.
+const IdempotencyKeyMaxLength = 255
+
+// DefaultIdempotencyTTL - сколько хранится ответ, если TTL не задан.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+type IdempotencyConfig struct {
+	// TTL - сколько ключ защищает от повторного выполнения запроса.
+	TTL time.Duration
+}
+
+// Idempotency запоминает ответы на запросы с ключом идемпотентности, чтобы
+// повтор запроса (например, после таймаута клиента) не списал монеты дважды.
+type Idempotency struct {
+	store db.Storage
+	cfg   IdempotencyConfig
+	now   func() time.Time
+}
+
+func NewIdempotency(store db.Storage, cfg IdempotencyConfig) *Idempotency {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultIdempotencyTTL
+	}
+	return &Idempotency{store: store, cfg: cfg, now: time.Now}
+}
+
+// Begin занимает ключ за запросом с отпечатком fingerprint. Если запрос
+// с этим ключом уже выполнен, возвращает сохранённый ответ. Иначе возвращает
+// nil, и вызывающий обязан завершить запрос через Complete или Release.
+func (i *Idempotency) Begin(ctx context.Context, username, key, fingerprint string) (*db.IdempotencyRecord, error) {
+	if !validIdempotencyKey(key) {
+		return nil, ErrInvalidIdempotencyKey
+	}
+
+	now := i.now()
+	existing, reserved, err := i.store.ReserveIdempotencyKey(ctx, db.IdempotencyRecord{
+		Username:    username,
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(i.cfg.TTL),
+	}, now)
+	if err != nil {
+		return nil, err
+	}
+	if reserved {
+		return nil, nil
+	}
+	if existing.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if existing.StatusCode == 0 {
+		return nil, ErrIdempotencyInProgress
+	}
+	return existing, nil
+}
+
+// Complete сохраняет ответ, который получат повторы запроса.
+func (i *Idempotency) Complete(ctx context.Context, username, key string, status int, contentType string, body []byte) error {
+	return i.store.CompleteIdempotencyKey(ctx, db.IdempotencyRecord{
+		Username:    username,
+		Key:         key,
+		StatusCode:  status,
+		ContentType: contentType,
+		Response:    body,
+	})
+}
+
+// Release освобождает ключ, если запрос не удалось выполнить и его можно
+// безопасно повторить.
+func (i *Idempotency) Release(ctx context.Context, username, key string) error {
+	return i.store.ReleaseIdempotencyKey(ctx, username, key)
+}
+
+// Purge удаляет истёкшие ключи и возвращает их число.
+func (i *Idempotency) Purge(ctx context.Context) (int64, error) {
+	n, err := i.store.DeleteExpiredIdempotencyKeys(ctx, i.now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+	return n, nil
+}
+
+// validIdempotencyKey допускает печатные ASCII-символы без пробелов.
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > IdempotencyKeyMaxLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/titoffon/merch-store/internal/db/memory"
+	"github.com/titoffon/merch-store/internal/service"
+)
+
+func TestIdempotency(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	idem := service.NewIdempotency(store, service.IdempotencyConfig{TTL: time.Hour})
+	now := time.Now()
+	service.SetIdempotencyNow(idem, func() time.Time { return now })
+
+	for _, key := range []string{"", "with space", strings.Repeat("k", service.IdempotencyKeyMaxLength+1)} {
+		if _, err := idem.Begin(ctx, "alice", key, "fp"); !errors.Is(err, service.ErrInvalidIdempotencyKey) {
+			t.Errorf("expected ErrInvalidIdempotencyKey for %q, got %v", key, err)
+		}
+	}
+
+	replay, err := idem.Begin(ctx, "alice", "key-1", "fp")
+	if err != nil || replay != nil {
+		t.Fatalf("expected the key to be reserved, got %+v (%v)", replay, err)
+	}
+	if _, err := idem.Begin(ctx, "alice", "key-1", "fp"); !errors.Is(err, service.ErrIdempotencyInProgress) {
+		t.Errorf("expected ErrIdempotencyInProgress, got %v", err)
+	}
+	if replay, err := idem.Begin(ctx, "bob", "key-1", "fp"); err != nil || replay != nil {
+		t.Errorf("expected keys to be scoped per user, got %+v (%v)", replay, err)
+	}
+
+	if err := idem.Complete(ctx, "alice", "key-1", 200, "application/json", []byte(`{"ok":true}`)); err != nil {
+		t.Fatalf("failed to complete: %v", err)
+	}
+	replay, err = idem.Begin(ctx, "alice", "key-1", "fp")
+	if err != nil || replay == nil || replay.StatusCode != 200 || string(replay.Response) != `{"ok":true}` {
+		t.Fatalf("expected the stored response, got %+v (%v)", replay, err)
+	}
+	if _, err := idem.Begin(ctx, "alice", "key-1", "other"); !errors.Is(err, service.ErrIdempotencyKeyReused) {
+		t.Errorf("expected ErrIdempotencyKeyReused, got %v", err)
+	}
+
+	if err := idem.Release(ctx, "bob", "key-1"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	if replay, err := idem.Begin(ctx, "bob", "key-1", "other"); err != nil || replay != nil {
+		t.Errorf("expected a released key to be reserved again, got %+v (%v)", replay, err)
+	}
+
+	// После TTL ключ снова свободен, а Purge удаляет истёкшие записи.
+	now = now.Add(2 * time.Hour)
+	if replay, err := idem.Begin(ctx, "alice", "key-1", "other"); err != nil || replay != nil {
+		t.Errorf("expected an expired key to be reserved again, got %+v (%v)", replay, err)
+	}
+	if n, err := idem.Purge(ctx); err != nil || n != 1 {
+		t.Errorf("expected 1 purged key, got %d (%v)", n, err)
+	}
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/titoffon/merch-store/internal/db"
+)
+
+// Действия в журнале аудита для заморозки счёта.
+const (
+	AuditAccountFreeze   = "account.freeze"
+	AuditAccountUnfreeze = "account.unfreeze"
+)
+
+// ReconcileActor - автор записей аудита, которые делает сверка балансов.
+const ReconcileActor = "reconcile"
+
+// reconcileLock - блокировка, под которой идёт сверка: два экземпляра
+// сервиса не замораживают счета одновременно.
+const reconcileLock = "reconcile balances"
+
+// Ledger сверяет кеш баланса пользователя с главной книгой и историей операций.
+type Ledger struct {
+	store db.Storage
+	now   func() time.Time
+}
+
+func NewLedger(store db.Storage) *Ledger {
+	return &Ledger{store: store, now: time.Now}
+}
+
+// Discrepancy - пользователь, чей баланс не сходится с книгой или историей.
+// Expected = Opening + Received - Sent - Spent + Refunded, где Opening -
+// приветственная или вводная проводка, которой открыт счёт.
+type Discrepancy struct {
+	Username string `json:"username"`
+	Balance  int64  `json:"balance"`
+	Ledger   int64  `json:"ledger"`
+	Expected int64  `json:"expected"`
+	Opening  int64  `json:"opening"`
+	Received int64  `json:"received"`
+	Sent     int64  `json:"sent"`
+	Spent    int64  `json:"spent"`
+	Refunded int64  `json:"refunded"`
+	Frozen   bool   `json:"frozen"`
+}
+
+// ReconcileReport - результат сверки. Frozen - счета, замороженные этой сверкой.
+type ReconcileReport struct {
+	CheckedAt  time.Time     `json:"checkedAt"`
+	Users      int           `json:"users"`
+	Mismatches []Discrepancy `json:"mismatches"`
+	Frozen     []string      `json:"frozen,omitempty"`
+}
+
+// Balance возвращает баланс пользователя из кеша users.balance и по книге.
+func (l *Ledger) Balance(ctx context.Context, username string) (cached, ledger int64, err error) {
+	user, err := l.store.GetUserByName(ctx, username)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get user by name: %w", err)
+	}
+	if user == nil {
+		return 0, 0, ErrUserNotFound
+	}
+	ledger, err = l.store.GetLedgerBalance(ctx, db.UserAccount(username))
+	if err != nil {
+		return 0, 0, err
+	}
+	return user.Balance, ledger, nil
+}
+
+// Verify возвращает ErrBalanceMismatch, если кеш баланса разошёлся с книгой.
+func (l *Ledger) Verify(ctx context.Context, username string) error {
+	cached, ledger, err := l.Balance(ctx, username)
+	if err != nil {
+		return err
+	}
+	if cached != ledger {
+		return fmt.Errorf("%w: %s has %d cached and %d in the ledger", ErrBalanceMismatch, username, cached, ledger)
+	}
+	return nil
+}
+
+// Reconcile пересчитывает баланс каждого пользователя по истории операций
+// и сравнивает его с users.balance и главной книгой. С freeze счета
+// с расхождением замораживаются. Если сверку уже выполняет другой процесс,
+// возвращает ErrReconcileInProgress.
+func (l *Ledger) Reconcile(ctx context.Context, freeze bool) (*ReconcileReport, error) {
+	unlock, ok, err := l.store.TryLock(ctx, reconcileLock)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrReconcileInProgress
+	}
+	defer unlock()
+
+	return l.reconcile(ctx, freeze)
+}
+
+// ReconcileScheduled выполняет сверку, запланированную на slot. Из всех
+// экземпляров сервиса её выполняет один: остальные, как и повторный запуск
+// за тот же slot, получают nil, nil.
+func (l *Ledger) ReconcileScheduled(ctx context.Context, slot time.Time, freeze bool) (*ReconcileReport, error) {
+	unlock, ok, err := l.store.TryLock(ctx, reconcileLock)
+	if err != nil || !ok {
+		return nil, err
+	}
+	defer unlock()
+
+	claimed, err := l.store.ClaimJobRun(ctx, reconcileLock, slot)
+	if err != nil || !claimed {
+		return nil, err
+	}
+	return l.reconcile(ctx, freeze)
+}
+
+func (l *Ledger) reconcile(ctx context.Context, freeze bool) (*ReconcileReport, error) {
+	history, err := l.store.ListBalanceHistory(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconcileReport{CheckedAt: l.now(), Users: len(history), Mismatches: []Discrepancy{}}
+	for _, h := range history {
+		expected := h.Opening + h.Received - h.Sent - h.Spent + h.Refunded
+		if h.Balance == h.Ledger && h.Balance == expected {
+			continue
+		}
+		d := Discrepancy{
+			Username: h.Username,
+			Balance:  h.Balance,
+			Ledger:   h.Ledger,
+			Expected: expected,
+			Opening:  h.Opening,
+			Received: h.Received,
+			Sent:     h.Sent,
+			Spent:    h.Spent,
+			Refunded: h.Refunded,
+			Frozen:   h.Frozen,
+		}
+		if freeze && !d.Frozen {
+			if err := l.setFrozen(ctx, ReconcileActor, d.Username, true, d); err != nil {
+				return nil, err
+			}
+			d.Frozen = true
+			report.Frozen = append(report.Frozen, d.Username)
+		}
+		report.Mismatches = append(report.Mismatches, d)
+	}
+	return report, nil
+}
+
+// Unfreeze снимает заморозку со счёта после ручной сверки.
+func (l *Ledger) Unfreeze(ctx context.Context, actor, username string) error {
+	return l.setFrozen(ctx, actor, username, false, nil)
+}
+
+func (l *Ledger) setFrozen(ctx context.Context, actor, username string, frozen bool, details any) error {
+	action := AuditAccountUnfreeze
+	if frozen {
+		action = AuditAccountFreeze
+	}
+	entry := db.AuditEntry{Actor: actor, Action: action, Target: db.UserAccount(username)}
+	if details != nil {
+		var err error
+		if entry.Details, err = json.Marshal(details); err != nil {
+			return fmt.Errorf("failed to encode audit details: %w", err)
+		}
+	}
+
+	return l.store.InTx(ctx, func(tx db.Tx) error {
+		if err := tx.SetUserFrozen(ctx, username, frozen); err != nil {
+			if errors.Is(err, db.ErrUserNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		return tx.InsertAuditEntry(ctx, entry)
+	})
+}
+
+// moveCoins проводит amount со счёта from на счёт to.
+func moveCoins(ctx context.Context, tx db.Tx, kind, reference, from, to string, amount int64) error {
+	_, err := tx.PostJournalEntry(ctx, db.JournalEntry{
+		Kind:      kind,
+		Reference: reference,
+		Postings: []db.Posting{
+			{Account: from, Amount: -amount},
+			{Account: to, Amount: amount},
+		},
+	})
+	switch {
+	case errors.Is(err, db.ErrLowBalance):
+		return ErrInsufficientFunds
+	case errors.Is(err, db.ErrAccountFrozen):
+		return ErrAccountFrozen
+	}
+	return err
+}
@@ -0,0 +1,181 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/titoffon/merch-store/internal/db"
+	"github.com/titoffon/merch-store/internal/db/memory"
+	"github.com/titoffon/merch-store/internal/service"
+)
+
+func TestLedgerFollowsBalance(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	newUser(t, store, "alice", 100)
+	newUser(t, store, "bob", 50)
+
+	shop := service.NewShop(store, service.ShopConfig{CancelWindow: time.Hour})
+	wallet := service.NewWallet(store)
+	ledger := service.NewLedger(store)
+
+	order, err := shop.PlaceOrder(ctx, "alice", []db.OrderLine{{Item: "pen", Quantity: 2}})
+	if err != nil {
+		t.Fatalf("failed to place order: %v", err)
+	}
+	if err := wallet.Transfer(ctx, "alice", "bob", 30, service.TransferNote{}); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	if _, err := shop.PlaceOrder(ctx, "bob", []db.OrderLine{{Item: "cup", Quantity: 1}}); err != nil {
+		t.Fatalf("failed to place order: %v", err)
+	}
+	if _, err := shop.CancelOrder(ctx, "alice", order.ID); err != nil {
+		t.Fatalf("failed to cancel order: %v", err)
+	}
+
+	for _, name := range []string{"alice", "bob"} {
+		if err := ledger.Verify(ctx, name); err != nil {
+			t.Errorf("expected %s to match the ledger: %v", name, err)
+		}
+	}
+	if _, _, err := ledger.Balance(ctx, "ghost"); !errors.Is(err, service.ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+
+	var sum int64
+	for _, account := range []string{db.AccountIssuance, db.AccountShop, db.UserAccount("alice"), db.UserAccount("bob")} {
+		balance, err := store.GetLedgerBalance(ctx, account)
+		if err != nil {
+			t.Fatalf("failed to get %s balance: %v", account, err)
+		}
+		sum += balance
+	}
+	if sum != 0 {
+		t.Errorf("expected the ledger to sum to zero, got %d", sum)
+	}
+	if shopBalance, _ := store.GetLedgerBalance(ctx, db.AccountShop); shopBalance != 20 {
+		t.Errorf("expected the shop to hold 20 coins after the refund, got %d", shopBalance)
+	}
+}
+
+func TestLedgerReconcile(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	newUser(t, store, "alice", service.WelcomCoins)
+	newUser(t, store, "bob", service.WelcomCoins)
+	// Счёт carol открыт не на WelcomCoins: это не расхождение, ожидаемый
+	// баланс считается от её приветственной проводки.
+	newUser(t, store, "carol", 500)
+	// А эти 100 монет пришли carol мимо истории операций.
+	err := store.InTx(ctx, func(tx db.Tx) error {
+		_, err := tx.PostJournalEntry(ctx, db.JournalEntry{
+			Kind:     db.EntryTransfer,
+			Postings: []db.Posting{{Account: db.AccountIssuance, Amount: -100}, {Account: db.UserAccount("carol"), Amount: 100}},
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to post entry: %v", err)
+	}
+
+	shop := service.NewShop(store, service.ShopConfig{CancelWindow: time.Hour})
+	wallet := service.NewWallet(store)
+	ledger := service.NewLedger(store)
+	now := time.Date(2025, 2, 1, 3, 0, 0, 0, time.UTC)
+	service.SetLedgerNow(ledger, func() time.Time { return now })
+
+	order, err := shop.PlaceOrder(ctx, "alice", []db.OrderLine{{Item: "cup", Quantity: 2}})
+	if err != nil {
+		t.Fatalf("failed to place order: %v", err)
+	}
+	if _, err := shop.CancelOrder(ctx, "alice", order.ID); err != nil {
+		t.Fatalf("failed to cancel order: %v", err)
+	}
+	if err := shop.Buy(ctx, "bob", "pen"); err != nil {
+		t.Fatalf("failed to buy: %v", err)
+	}
+	if err := wallet.Transfer(ctx, "alice", "carol", 100, service.TransferNote{}); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+
+	report, err := ledger.Reconcile(ctx, false)
+	if err != nil {
+		t.Fatalf("failed to reconcile: %v", err)
+	}
+	want := service.Discrepancy{Username: "carol", Balance: 700, Ledger: 700, Expected: 600, Opening: 500, Received: 100}
+	if !report.CheckedAt.Equal(now) || report.Users != 3 || len(report.Mismatches) != 1 || report.Mismatches[0] != want {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if len(report.Frozen) != 0 {
+		t.Errorf("expected no accounts to be frozen without freeze, got %v", report.Frozen)
+	}
+
+	report, err = ledger.Reconcile(ctx, true)
+	if err != nil {
+		t.Fatalf("failed to reconcile: %v", err)
+	}
+	if len(report.Frozen) != 1 || report.Frozen[0] != "carol" || !report.Mismatches[0].Frozen {
+		t.Fatalf("expected carol to be frozen, got %+v", report)
+	}
+	entries, _ := store.ListAuditEntries(ctx, db.UserAccount("carol"), 10)
+	if len(entries) != 1 || entries[0].Action != service.AuditAccountFreeze || entries[0].Actor != service.ReconcileActor {
+		t.Errorf("unexpected audit entries: %+v", entries)
+	}
+
+	if err := wallet.Transfer(ctx, "carol", "alice", 10, service.TransferNote{}); !errors.Is(err, service.ErrAccountFrozen) {
+		t.Errorf("expected ErrAccountFrozen for a transfer, got %v", err)
+	}
+	if err := shop.Buy(ctx, "carol", "pen"); !errors.Is(err, service.ErrAccountFrozen) {
+		t.Errorf("expected ErrAccountFrozen for a purchase, got %v", err)
+	}
+	if err := wallet.Transfer(ctx, "alice", "carol", 10, service.TransferNote{}); err != nil {
+		t.Errorf("expected a frozen account to accept coins, got %v", err)
+	}
+
+	if report, _ := ledger.Reconcile(ctx, true); len(report.Frozen) != 0 {
+		t.Errorf("expected an already frozen account to stay as is, got %v", report.Frozen)
+	}
+	if err := ledger.Unfreeze(ctx, "admin", "carol"); err != nil {
+		t.Fatalf("failed to unfreeze: %v", err)
+	}
+	if err := ledger.Unfreeze(ctx, "admin", "ghost"); !errors.Is(err, service.ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+	if err := shop.Buy(ctx, "carol", "pen"); err != nil {
+		t.Errorf("expected an unfrozen account to spend coins, got %v", err)
+	}
+}
+
+func TestLedgerReconcileRunsOnce(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	newUser(t, store, "alice", service.WelcomCoins)
+	ledger := service.NewLedger(store)
+	slot := time.Date(2025, 2, 1, 3, 0, 0, 0, time.UTC)
+
+	report, err := ledger.ReconcileScheduled(ctx, slot, false)
+	if err != nil || report == nil || report.Users != 1 {
+		t.Fatalf("expected the scheduled run to reconcile, got %+v, %v", report, err)
+	}
+	if report, err := ledger.ReconcileScheduled(ctx, slot, false); err != nil || report != nil {
+		t.Errorf("expected the same slot to be skipped, got %+v, %v", report, err)
+	}
+
+	unlock, ok, err := store.TryLock(ctx, "reconcile balances")
+	if err != nil || !ok {
+		t.Fatalf("failed to take the lock: %v", err)
+	}
+	if _, err := ledger.Reconcile(ctx, false); !errors.Is(err, service.ErrReconcileInProgress) {
+		t.Errorf("expected ErrReconcileInProgress, got %v", err)
+	}
+	next := slot.Add(24 * time.Hour)
+	if report, err := ledger.ReconcileScheduled(ctx, next, false); err != nil || report != nil {
+		t.Errorf("expected a locked run to be skipped, got %+v, %v", report, err)
+	}
+	unlock()
+	if report, err := ledger.ReconcileScheduled(ctx, next, false); err != nil || report == nil {
+		t.Errorf("expected the next slot to run after unlock, got %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// LockoutConfig задаёт защиту входа от подбора пароля. После Threshold
+// неудач подряд по имени (или IPThreshold по адресу) вход блокируется на
+// BaseDelay, и каждая следующая неудача удваивает блокировку до MaxDelay.
+// Счётчик сбрасывается успешным входом или если неудач не было дольше Window.
+type LockoutConfig struct {
+	// Threshold - неудачных входов по имени до блокировки. Ноль выключает защиту.
+	Threshold int
+	// IPThreshold - неудачных входов с одного адреса до блокировки. Ноль
+	// выключает блокировку по адресу.
+	IPThreshold int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Window      time.Duration
+}
+
+// LockedError возвращает Login, пока вход заблокирован. errors.Is(err,
+// ErrTooManyAttempts) для него истинно.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s, retry in %s", ErrTooManyAttempts, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LockedError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+type lockKey struct {
+	key       string
+	threshold int
+}
+
+func userLockKey(username string) string {
+	return "user:" + username
+}
+
+func (a *Auth) lockKeys(username, ip string) []lockKey {
+	if a.cfg.Lockout.Threshold <= 0 {
+		return nil
+	}
+	keys := []lockKey{{key: userLockKey(username), threshold: a.cfg.Lockout.Threshold}}
+	if ip != "" && a.cfg.Lockout.IPThreshold > 0 {
+		keys = append(keys, lockKey{key: "ip:" + ip, threshold: a.cfg.Lockout.IPThreshold})
+	}
+	return keys
+}
+
+// checkLock возвращает *LockedError, если хотя бы один ключ заблокирован,
+// и сообщает, есть ли у пользователя неудачные попытки.
+func (a *Auth) checkLock(ctx context.Context, keys []lockKey) (bool, error) {
+	var hasFailures bool
+	var retryAfter time.Duration
+	now := a.now()
+
+	for i, k := range keys {
+		lf, err := a.store.GetLoginFailure(ctx, k.key)
+		if err != nil {
+			return false, err
+		}
+		if lf == nil {
+			continue
+		}
+		if i == 0 {
+			hasFailures = true
+		}
+		if lf.LockedUntil != nil && now.Before(*lf.LockedUntil) {
+			retryAfter = max(retryAfter, lf.LockedUntil.Sub(now))
+		}
+	}
+
+	if retryAfter > 0 {
+		return hasFailures, &LockedError{RetryAfter: retryAfter}
+	}
+	return hasFailures, nil
+}
+
+func (a *Auth) recordFailure(ctx context.Context, keys []lockKey) error {
+	now := a.now()
+	for _, k := range keys {
+		failures, err := a.store.AddLoginFailure(ctx, k.key, now, a.cfg.Lockout.Window)
+		if err != nil {
+			return err
+		}
+		if failures < k.threshold {
+			continue
+		}
+
+		delay := a.lockDelay(failures - k.threshold)
+		if err := a.store.LockLogin(ctx, k.key, now.Add(delay)); err != nil {
+			return err
+		}
+		slog.Warn("Login locked after failed attempts",
+			slog.String("key", k.key),
+			slog.Int("failures", failures),
+			slog.Duration("delay", delay),
+		)
+	}
+	return nil
+}
+
+// lockDelay - BaseDelay * 2^extra, но не больше MaxDelay.
+func (a *Auth) lockDelay(extra int) time.Duration {
+	delay := a.cfg.Lockout.BaseDelay
+	for i := 0; i < extra && delay < a.cfg.Lockout.MaxDelay; i++ {
+		delay *= 2
+	}
+	if a.cfg.Lockout.MaxDelay > 0 && delay > a.cfg.Lockout.MaxDelay {
+		delay = a.cfg.Lockout.MaxDelay
+	}
+	return delay
+}
+
+// Unlock снимает блокировку входа и сбрасывает счётчик неудач пользователя.
+// Счётчики по адресу не сбрасываются: адрес, с которого ошибался пользователь,
+// не хранится, и он остаётся заблокирован, пока не истечёт блокировка адреса.
+func (a *Auth) Unlock(ctx context.Context, username string) error {
+	if username == "" {
+		return fmt.Errorf("%w: must not be empty", ErrInvalidUsername)
+	}
+	user, err := a.store.GetUserByName(ctx, username)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve user: %w", err)
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	if err := a.store.ResetLoginFailures(ctx, userLockKey(username)); err != nil {
+		return err
+	}
+	slog.Info("Login unlocked", slog.String("username", username))
+	return nil
+}
+
+// PurgeLoginFailures удаляет счётчики неудач, которые больше ничего не
+// блокируют, и возвращает их число. Без неё таблицу раздували бы неудачные
+// входы под несуществующими именами.
+func (a *Auth) PurgeLoginFailures(ctx context.Context) (int64, error) {
+	n, err := a.store.DeleteStaleLoginFailures(ctx, a.now(), a.cfg.Lockout.Window)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge login failures: %w", err)
+	}
+	return n, nil
+}
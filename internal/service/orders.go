@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/titoffon/merch-store/internal/db"
+)
+
+const (
+	OrderMaxLines        = 50
+	OrderMaxLineQuantity = 100
+	// OrderListLimit - сколько заказов отдаёт список, если лимит не задан.
+	OrderListLimit    = 100
+	OrderListMaxLimit = 500
+)
+
+// Изменения заказов в журнале аудита.
+const (
+	AuditOrderStatus = "order.status"
+	AuditOrderCancel = "order.cancel"
+)
+
+// orderTransitions - допустимые смены статуса через AdvanceOrder.
+var orderTransitions = map[string]string{
+	db.OrderPlaced: db.OrderReady,
+	db.OrderReady:  db.OrderHandedOver,
+}
+
+// PlaceOrder оценивает корзину, списывает товары со склада и сумму заказа
+// с баланса одной транзакцией. Строки с одинаковым товаром объединяются.
+func (s *Shop) PlaceOrder(ctx context.Context, username string, lines []db.OrderLine) (*db.Order, error) {
+	lines, err := normalizeOrderLines(lines)
+	if err != nil {
+		return nil, err
+	}
+
+	var order *db.Order
+	err = s.store.InTx(ctx, func(tx db.Tx) error {
+		var err error
+		order, err = s.placeOrder(ctx, tx, username, lines)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (s *Shop) placeOrder(ctx context.Context, tx db.Tx, username string, lines []db.OrderLine) (*db.Order, error) {
+	// Строки отсортированы по товару, поэтому конкурентные заказы
+	// блокируют товары в одном порядке.
+	// Цена фиксируется в строке заказа и потом не зависит от каталога.
+	var total int64
+	for i, line := range lines {
+		item, err := tx.GetMerchItemForUpdate(ctx, line.Item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get item %q: %w", line.Item, err)
+		}
+		if item == nil || !item.Active {
+			return nil, fmt.Errorf("%w: %q", ErrItemNotFound, line.Item)
+		}
+		lines[i].Price = item.Price
+		total += item.Price * line.Quantity
+	}
+
+	for _, line := range lines {
+		if err := tx.TakeMerchStock(ctx, line.Item, line.Quantity); err != nil {
+			if errors.Is(err, db.ErrOutOfStock) {
+				return nil, fmt.Errorf("%w: %q", ErrOutOfStock, line.Item)
+			}
+			return nil, err
+		}
+	}
+
+	order, err := tx.InsertOrder(ctx, db.Order{Username: username, Total: total, Lines: lines})
+	if err != nil {
+		return nil, err
+	}
+	err = moveCoins(ctx, tx, db.EntryPurchase, orderAuditTarget(order.ID), db.UserAccount(username), db.AccountShop, total)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		err := tx.InsertPurchases(ctx, db.Purchases{
+			Username:   username,
+			Merch_item: line.Item,
+			OrderID:    order.ID,
+			Quantity:   line.Quantity,
+			Price:      line.Price,
+			Currency:   db.CurrencyCoin,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Order возвращает заказ пользователя. Чужой заказ не отличается от
+// несуществующего.
+func (s *Shop) Order(ctx context.Context, username string, id int64) (*db.Order, error) {
+	order, err := s.store.GetOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil || order.Username != username {
+		return nil, ErrOrderNotFound
+	}
+	return order, nil
+}
+
+// ListOrders возвращает заказы по фильтру, новые первыми.
+func (s *Shop) ListOrders(ctx context.Context, filter db.OrderFilter) ([]db.Order, error) {
+	if filter.Status != "" && !db.ValidOrderStatus(filter.Status) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidOrderStatus, filter.Status)
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = OrderListLimit
+	}
+	filter.Limit = min(filter.Limit, OrderListMaxLimit)
+	return s.store.ListOrders(ctx, filter)
+}
+
+// AdvanceOrder переводит заказ в следующий статус от имени администратора
+// actor: placed -> ready -> handed_over. Смена пишется в журнал аудита.
+func (s *Shop) AdvanceOrder(ctx context.Context, actor string, id int64, status string) (*db.Order, error) {
+	if !db.ValidOrderStatus(status) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidOrderStatus, status)
+	}
+
+	var order *db.Order
+	err := s.store.InTx(ctx, func(tx db.Tx) error {
+		var err error
+		order, err = tx.GetOrderForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+		if order == nil {
+			return ErrOrderNotFound
+		}
+		if orderTransitions[order.Status] != status {
+			return fmt.Errorf("%w: %s -> %s", ErrOrderStatusConflict, order.Status, status)
+		}
+
+		if err := tx.SetOrderStatus(ctx, id, status); err != nil {
+			return err
+		}
+		return auditOrder(ctx, tx, actor, AuditOrderStatus, id, order.Status, status)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	order.Status = status
+	order.UpdatedAt = s.now()
+	return order, nil
+}
+
+// CancelOrder отменяет заказ пользователя username. Сам пользователь может
+// отменить только ещё не собранный заказ и только в течение CancelWindow.
+func (s *Shop) CancelOrder(ctx context.Context, username string, id int64) (*db.Order, error) {
+	return s.cancel(ctx, username, id, func(order *db.Order) error {
+		if order.Username != username {
+			return ErrOrderNotFound
+		}
+		if order.Status != db.OrderPlaced {
+			return fmt.Errorf("%w: order is %s", ErrOrderStatusConflict, order.Status)
+		}
+		if s.now().Sub(order.CreatedAt) > s.cfg.CancelWindow {
+			return ErrCancelWindowExpired
+		}
+		return nil
+	})
+}
+
+// CancelOrderAdmin отменяет любой ещё не выданный заказ от имени
+// администратора actor.
+func (s *Shop) CancelOrderAdmin(ctx context.Context, actor string, id int64) (*db.Order, error) {
+	return s.cancel(ctx, actor, id, func(order *db.Order) error {
+		if order.Status != db.OrderPlaced && order.Status != db.OrderReady {
+			return fmt.Errorf("%w: order is %s", ErrOrderStatusConflict, order.Status)
+		}
+		return nil
+	})
+}
+
+// cancel возвращает товары заказа на склад, а сумму - на баланс покупателя,
+// и записывает возврат одной транзакцией. check решает, можно ли отменять.
+func (s *Shop) cancel(ctx context.Context, actor string, id int64, check func(*db.Order) error) (*db.Order, error) {
+	var order *db.Order
+	err := s.store.InTx(ctx, func(tx db.Tx) error {
+		var err error
+		order, err = s.cancelOrder(ctx, tx, actor, id, check)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	order.Status = db.OrderCancelled
+	order.UpdatedAt = s.now()
+	return order, nil
+}
+
+func (s *Shop) cancelOrder(ctx context.Context, tx db.Tx, actor string, id int64, check func(*db.Order) error) (*db.Order, error) {
+	order, err := tx.GetOrderForUpdate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	if err := check(order); err != nil {
+		return nil, err
+	}
+
+	for _, line := range order.Lines {
+		_, err := tx.AddMerchStock(ctx, line.Item, line.Quantity)
+		if err != nil && !errors.Is(err, db.ErrUnlimitedStock) {
+			return nil, fmt.Errorf("failed to return %q to stock: %w", line.Item, err)
+		}
+	}
+
+	// Возвращается то, что пользователь заплатил, а не текущая цена товаров.
+	var amount int64
+	for _, line := range order.Lines {
+		amount += line.Price * line.Quantity
+	}
+	err = moveCoins(ctx, tx, db.EntryRefund, orderAuditTarget(order.ID), db.AccountShop, db.UserAccount(order.Username), amount)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.InsertRefund(ctx, db.Refund{OrderID: order.ID, Username: order.Username, Amount: amount})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.SetOrderStatus(ctx, id, db.OrderCancelled); err != nil {
+		return nil, err
+	}
+	if err := auditOrder(ctx, tx, actor, AuditOrderCancel, id, order.Status, db.OrderCancelled); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func orderAuditTarget(id int64) string {
+	return "order:" + strconv.FormatInt(id, 10)
+}
+
+func auditOrder(ctx context.Context, tx db.Tx, actor, action string, id int64, from, to string) error {
+	details, err := json.Marshal(struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}{from, to})
+	if err != nil {
+		return fmt.Errorf("failed to encode audit details: %w", err)
+	}
+	return tx.InsertAuditEntry(ctx, db.AuditEntry{
+		Actor:   actor,
+		Action:  action,
+		Target:  orderAuditTarget(id),
+		Details: details,
+	})
+}
+
+// normalizeOrderLines проверяет корзину, объединяет строки с одинаковым
+// товаром и сортирует их по имени товара.
+func normalizeOrderLines(lines []db.OrderLine) ([]db.OrderLine, error) {
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%w: order has no lines", ErrInvalidOrder)
+	}
+	quantities := make(map[string]int64, len(lines))
+	for _, line := range lines {
+		if line.Item == "" {
+			return nil, fmt.Errorf("%w: item name is required", ErrInvalidOrder)
+		}
+		if line.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity of %q must be positive", ErrInvalidOrder, line.Item)
+		}
+		quantities[line.Item] += line.Quantity
+		if quantities[line.Item] > OrderMaxLineQuantity {
+			return nil, fmt.Errorf("%w: at most %d units of %q per order", ErrInvalidOrder, OrderMaxLineQuantity, line.Item)
+		}
+	}
+	if len(quantities) > OrderMaxLines {
+		return nil, fmt.Errorf("%w: at most %d different items per order", ErrInvalidOrder, OrderMaxLines)
+	}
+
+	merged := make([]db.OrderLine, 0, len(quantities))
+	for item, qty := range quantities {
+		merged = append(merged, db.OrderLine{Item: item, Quantity: qty})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Item < merged[j].Item })
+	return merged, nil
+}
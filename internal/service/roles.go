@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/titoffon/merch-store/internal/db"
+	"github.com/titoffon/merch-store/internal/rbac"
+)
+
+// SetRoles заменяет роли пользователя. Изменения попадают в access-токены
+// при следующем входе или обновлении токена.
+func (a *Auth) SetRoles(ctx context.Context, username string, roles []string) error {
+	for _, role := range roles {
+		if !rbac.Valid(role) {
+			return fmt.Errorf("%w: %q", ErrUnknownRole, role)
+		}
+	}
+	roles = slices.Compact(slices.Sorted(slices.Values(roles)))
+
+	if err := a.store.SetUserRoles(ctx, username, roles); err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	slog.Info("User roles updated", slog.String("username", username), slog.Any("roles", roles))
+	return nil
+}
+
+// GrantRole добавляет пользователю роль, сохраняя остальные.
+func (a *Auth) GrantRole(ctx context.Context, username, role string) error {
+	user, err := a.store.GetUserByName(ctx, username)
+	if err != nil {
+		return fmt.Errorf("failed to get user by name: %w", err)
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	return a.SetRoles(ctx, username, append(slices.Clone(user.Roles), role))
+}
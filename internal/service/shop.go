@@ -0,0 +1,31 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/titoffon/merch-store/internal/db"
+)
+
+type ShopConfig struct {
+	// CancelWindow - сколько после оформления пользователь может сам
+	// отменить заказ. Ноль - отменять может только администратор.
+	CancelWindow time.Duration
+}
+
+// Shop продаёт мерч за монеты.
+type Shop struct {
+	store db.Storage
+	cfg   ShopConfig
+	now   func() time.Time
+}
+
+func NewShop(store db.Storage, cfg ShopConfig) *Shop {
+	return &Shop{store: store, cfg: cfg, now: time.Now}
+}
+
+// Buy покупает одну штуку товара - это заказ из одной строки.
+func (s *Shop) Buy(ctx context.Context, username, item string) error {
+	_, err := s.PlaceOrder(ctx, username, []db.OrderLine{{Item: item, Quantity: 1}})
+	return err
+}
@@ -0,0 +1,430 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/titoffon/merch-store/internal/db"
+	"github.com/titoffon/merch-store/internal/db/memory"
+	"github.com/titoffon/merch-store/internal/service"
+)
+
+func newUser(t *testing.T, store db.Storage, username string, balance int64) {
+	t.Helper()
+	if _, err := store.CreateUser(context.Background(), db.User{Username: username, Balance: balance}); err != nil {
+		t.Fatalf("failed to create user %s: %v", username, err)
+	}
+}
+
+func TestShopBuy(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	newUser(t, store, "buyer", 100)
+
+	shop := service.NewShop(store, service.ShopConfig{})
+	account := service.NewAccount(store)
+
+	if err := shop.Buy(ctx, "buyer", "t-shirt"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := shop.Buy(ctx, "buyer", "t-shirt"); !errors.Is(err, service.ErrInsufficientFunds) {
+		t.Errorf("expected ErrInsufficientFunds, got %v", err)
+	}
+	if err := shop.Buy(ctx, "buyer", "no-such-item"); !errors.Is(err, service.ErrItemNotFound) {
+		t.Errorf("expected ErrItemNotFound, got %v", err)
+	}
+
+	info, err := account.Info(ctx, "buyer")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if info.Balance != 20 {
+		t.Errorf("expected balance 20, got %d", info.Balance)
+	}
+	if len(info.Inventory) != 1 || info.Inventory[0].MerchItem != "t-shirt" || info.Inventory[0].Quantity != 1 {
+		t.Errorf("unexpected inventory: %v", info.Inventory)
+	}
+}
+
+func TestShopBuyLimitedStock(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	catalog := service.NewCatalog(store)
+	shop := service.NewShop(store, service.ShopConfig{})
+
+	stock := int64(3)
+	if _, err := catalog.Create(ctx, "admin", db.MerchItem{Name: "limited-hoody", Price: 10, Active: true, Stock: &stock}); err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+
+	const buyers = 8
+	for i := 0; i < buyers; i++ {
+		newUser(t, store, fmt.Sprintf("buyer-%d", i), 100)
+	}
+
+	var sold, outOfStock atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := shop.Buy(ctx, fmt.Sprintf("buyer-%d", i), "limited-hoody")
+			switch {
+			case err == nil:
+				sold.Add(1)
+			case errors.Is(err, service.ErrOutOfStock):
+				outOfStock.Add(1)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if sold.Load() != 3 || outOfStock.Load() != buyers-3 {
+		t.Errorf("expected 3 sold and %d out of stock, got %d and %d", buyers-3, sold.Load(), outOfStock.Load())
+	}
+	item, _ := catalog.Item(ctx, "limited-hoody")
+	if item.Stock == nil || *item.Stock != 0 || item.Available() {
+		t.Errorf("expected item to be sold out, got %+v", item)
+	}
+
+	// Неудачные покупки не списывают монеты.
+	var total int64
+	for i := 0; i < buyers; i++ {
+		user, _ := store.GetUserByName(ctx, fmt.Sprintf("buyer-%d", i))
+		total += user.Balance
+	}
+	if total != buyers*100-3*10 {
+		t.Errorf("expected %d coins left in total, got %d", buyers*100-3*10, total)
+	}
+
+	if _, err := catalog.Restock(ctx, "admin", "limited-hoody", 1); err != nil {
+		t.Fatalf("failed to restock: %v", err)
+	}
+	if err := shop.Buy(ctx, "buyer-0", "limited-hoody"); err != nil {
+		t.Errorf("expected purchase after restock, got %v", err)
+	}
+
+	if _, err := catalog.SetStock(ctx, "admin", "limited-hoody", nil); err != nil {
+		t.Fatalf("failed to set stock: %v", err)
+	}
+	if _, err := catalog.Restock(ctx, "admin", "limited-hoody", 1); !errors.Is(err, service.ErrUnlimitedStock) {
+		t.Errorf("expected ErrUnlimitedStock, got %v", err)
+	}
+	if err := shop.Buy(ctx, "buyer-1", "limited-hoody"); err != nil {
+		t.Errorf("expected unlimited item to be sold, got %v", err)
+	}
+}
+
+func TestShopPlaceOrder(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	newUser(t, store, "buyer", 100)
+
+	shop := service.NewShop(store, service.ShopConfig{})
+	account := service.NewAccount(store)
+
+	order, err := shop.PlaceOrder(ctx, "buyer", []db.OrderLine{
+		{Item: "pen", Quantity: 3},
+		{Item: "cup", Quantity: 1},
+		{Item: "pen", Quantity: 2},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if order.ID == 0 || order.Total != 5*10+20 {
+		t.Errorf("unexpected order: %+v", order)
+	}
+	want := []db.OrderLine{{Item: "cup", Quantity: 1, Price: 20}, {Item: "pen", Quantity: 5, Price: 10}}
+	if len(order.Lines) != len(want) || order.Lines[0] != want[0] || order.Lines[1] != want[1] {
+		t.Errorf("expected lines %v, got %v", want, order.Lines)
+	}
+
+	tests := []struct {
+		name  string
+		lines []db.OrderLine
+		want  error
+	}{
+		{"empty cart", nil, service.ErrInvalidOrder},
+		{"zero quantity", []db.OrderLine{{Item: "pen"}}, service.ErrInvalidOrder},
+		{"too many units", []db.OrderLine{{Item: "pen", Quantity: service.OrderMaxLineQuantity}, {Item: "pen", Quantity: 1}}, service.ErrInvalidOrder},
+		{"unknown item", []db.OrderLine{{Item: "pen", Quantity: 1}, {Item: "no-such-item", Quantity: 1}}, service.ErrItemNotFound},
+		{"not enough coins", []db.OrderLine{{Item: "cup", Quantity: 1}, {Item: "socks", Quantity: 2}}, service.ErrInsufficientFunds},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := shop.PlaceOrder(ctx, "buyer", tt.lines); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// Отклонённые заказы ничего не списывают.
+	info, err := account.Info(ctx, "buyer")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if info.Balance != 30 {
+		t.Errorf("expected balance 30, got %d", info.Balance)
+	}
+	if len(info.Inventory) != 2 || info.Inventory[1].MerchItem != "pen" || info.Inventory[1].Quantity != 5 {
+		t.Errorf("unexpected inventory: %v", info.Inventory)
+	}
+}
+
+func TestShopPlaceOrderOutOfStock(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	catalog := service.NewCatalog(store)
+	shop := service.NewShop(store, service.ShopConfig{})
+	newUser(t, store, "buyer", 1000)
+
+	stock := int64(2)
+	if _, err := catalog.Create(ctx, "admin", db.MerchItem{Name: "sticker", Price: 5, Active: true, Stock: &stock}); err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+
+	_, err := shop.PlaceOrder(ctx, "buyer", []db.OrderLine{{Item: "pen", Quantity: 1}, {Item: "sticker", Quantity: 3}})
+	if !errors.Is(err, service.ErrOutOfStock) {
+		t.Fatalf("expected ErrOutOfStock, got %v", err)
+	}
+	item, _ := catalog.Item(ctx, "sticker")
+	if *item.Stock != 2 {
+		t.Errorf("expected stock to stay 2, got %d", *item.Stock)
+	}
+	user, _ := store.GetUserByName(ctx, "buyer")
+	if user.Balance != 1000 {
+		t.Errorf("expected balance to stay 1000, got %d", user.Balance)
+	}
+
+	if _, err := shop.PlaceOrder(ctx, "buyer", []db.OrderLine{{Item: "sticker", Quantity: 2}}); err != nil {
+		t.Errorf("expected the rest of the stock to be sold, got %v", err)
+	}
+}
+
+func TestShopOrderLifecycle(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	shop := service.NewShop(store, service.ShopConfig{})
+	newUser(t, store, "alice", 1000)
+	newUser(t, store, "bob", 1000)
+
+	first, err := shop.PlaceOrder(ctx, "alice", []db.OrderLine{{Item: "pen", Quantity: 2}})
+	if err != nil {
+		t.Fatalf("failed to place order: %v", err)
+	}
+	if first.Status != db.OrderPlaced {
+		t.Errorf("expected status %q, got %q", db.OrderPlaced, first.Status)
+	}
+	if _, err := shop.PlaceOrder(ctx, "alice", []db.OrderLine{{Item: "cup", Quantity: 1}}); err != nil {
+		t.Fatalf("failed to place order: %v", err)
+	}
+	if _, err := shop.PlaceOrder(ctx, "bob", []db.OrderLine{{Item: "book", Quantity: 1}}); err != nil {
+		t.Fatalf("failed to place order: %v", err)
+	}
+
+	order, err := shop.Order(ctx, "alice", first.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(order.Lines) != 1 || order.Lines[0] != (db.OrderLine{Item: "pen", Quantity: 2, Price: 10}) || order.Total != 20 {
+		t.Errorf("unexpected order: %+v", order)
+	}
+	if _, err := shop.Order(ctx, "bob", first.ID); !errors.Is(err, service.ErrOrderNotFound) {
+		t.Errorf("expected ErrOrderNotFound for someone else's order, got %v", err)
+	}
+
+	orders, err := shop.ListOrders(ctx, db.OrderFilter{Username: "alice"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(orders) != 2 || orders[0].Lines[0].Item != "cup" {
+		t.Errorf("expected alice's orders newest first, got %+v", orders)
+	}
+	if _, err := shop.ListOrders(ctx, db.OrderFilter{Status: "lost"}); !errors.Is(err, service.ErrInvalidOrderStatus) {
+		t.Errorf("expected ErrInvalidOrderStatus, got %v", err)
+	}
+
+	if _, err := shop.AdvanceOrder(ctx, "admin", first.ID, db.OrderHandedOver); !errors.Is(err, service.ErrOrderStatusConflict) {
+		t.Errorf("expected ErrOrderStatusConflict when skipping ready, got %v", err)
+	}
+	for _, status := range []string{db.OrderReady, db.OrderHandedOver} {
+		order, err := shop.AdvanceOrder(ctx, "admin", first.ID, status)
+		if err != nil {
+			t.Fatalf("failed to set %s: %v", status, err)
+		}
+		if order.Status != status {
+			t.Errorf("expected status %q, got %q", status, order.Status)
+		}
+	}
+	if _, err := shop.AdvanceOrder(ctx, "admin", first.ID, db.OrderReady); !errors.Is(err, service.ErrOrderStatusConflict) {
+		t.Errorf("expected ErrOrderStatusConflict after hand-over, got %v", err)
+	}
+	if _, err := shop.AdvanceOrder(ctx, "admin", 100, db.OrderReady); !errors.Is(err, service.ErrOrderNotFound) {
+		t.Errorf("expected ErrOrderNotFound, got %v", err)
+	}
+
+	ready, err := shop.ListOrders(ctx, db.OrderFilter{Status: db.OrderPlaced})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(ready) != 2 {
+		t.Errorf("expected 2 placed orders, got %d", len(ready))
+	}
+
+	entries, err := store.ListAuditEntries(ctx, fmt.Sprintf("order:%d", first.ID), 10)
+	if err != nil {
+		t.Fatalf("failed to list audit entries: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Action != service.AuditOrderStatus || entries[0].Actor != "admin" {
+		t.Errorf("unexpected audit entries: %+v", entries)
+	}
+}
+
+func TestShopCancelOrder(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	catalog := service.NewCatalog(store)
+	shop := service.NewShop(store, service.ShopConfig{CancelWindow: time.Hour})
+	account := service.NewAccount(store)
+	newUser(t, store, "alice", 1000)
+
+	stock := int64(5)
+	if _, err := catalog.Create(ctx, "admin", db.MerchItem{Name: "sticker", Price: 5, Active: true, Stock: &stock}); err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+	lines := []db.OrderLine{{Item: "sticker", Quantity: 2}, {Item: "pen", Quantity: 1}}
+
+	order, err := shop.PlaceOrder(ctx, "alice", lines)
+	if err != nil {
+		t.Fatalf("failed to place order: %v", err)
+	}
+	if _, err := shop.CancelOrder(ctx, "mallory", order.ID); !errors.Is(err, service.ErrOrderNotFound) {
+		t.Errorf("expected ErrOrderNotFound for someone else's order, got %v", err)
+	}
+	cancelled, err := shop.CancelOrder(ctx, "alice", order.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cancelled.Status != db.OrderCancelled {
+		t.Errorf("expected status %q, got %q", db.OrderCancelled, cancelled.Status)
+	}
+	if _, err := shop.CancelOrder(ctx, "alice", order.ID); !errors.Is(err, service.ErrOrderStatusConflict) {
+		t.Errorf("expected ErrOrderStatusConflict for a second cancellation, got %v", err)
+	}
+
+	item, _ := catalog.Item(ctx, "sticker")
+	if *item.Stock != 5 {
+		t.Errorf("expected stock to be restored to 5, got %d", *item.Stock)
+	}
+	info, err := account.Info(ctx, "alice")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if info.Balance != 1000 || len(info.Inventory) != 0 {
+		t.Errorf("expected a full refund and empty inventory, got balance %d and %v", info.Balance, info.Inventory)
+	}
+	if len(info.Refunds) != 1 || info.Refunds[0].OrderID != order.ID || info.Refunds[0].Amount != 20 {
+		t.Errorf("unexpected refunds: %+v", info.Refunds)
+	}
+
+	// Пользователь не может отменить заказ после окна или после сборки,
+	// администратор - пока заказ не выдан.
+	late, err := shop.PlaceOrder(ctx, "alice", lines)
+	if err != nil {
+		t.Fatalf("failed to place order: %v", err)
+	}
+	service.SetShopNow(shop, func() time.Time { return time.Now().Add(2 * time.Hour) })
+	if _, err := shop.CancelOrder(ctx, "alice", late.ID); !errors.Is(err, service.ErrCancelWindowExpired) {
+		t.Errorf("expected ErrCancelWindowExpired, got %v", err)
+	}
+	service.SetShopNow(shop, time.Now)
+
+	ready, err := shop.PlaceOrder(ctx, "alice", lines)
+	if err != nil {
+		t.Fatalf("failed to place order: %v", err)
+	}
+	if _, err := shop.AdvanceOrder(ctx, "admin", ready.ID, db.OrderReady); err != nil {
+		t.Fatalf("failed to advance order: %v", err)
+	}
+	if _, err := shop.CancelOrder(ctx, "alice", ready.ID); !errors.Is(err, service.ErrOrderStatusConflict) {
+		t.Errorf("expected ErrOrderStatusConflict for a ready order, got %v", err)
+	}
+	if _, err := shop.CancelOrderAdmin(ctx, "admin", ready.ID); err != nil {
+		t.Errorf("expected admin to cancel a ready order, got %v", err)
+	}
+
+	if _, err := shop.AdvanceOrder(ctx, "admin", late.ID, db.OrderReady); err != nil {
+		t.Fatalf("failed to advance order: %v", err)
+	}
+	if _, err := shop.AdvanceOrder(ctx, "admin", late.ID, db.OrderHandedOver); err != nil {
+		t.Fatalf("failed to advance order: %v", err)
+	}
+	if _, err := shop.CancelOrderAdmin(ctx, "admin", late.ID); !errors.Is(err, service.ErrOrderStatusConflict) {
+		t.Errorf("expected ErrOrderStatusConflict for a handed over order, got %v", err)
+	}
+
+	user, _ := store.GetUserByName(ctx, "alice")
+	if user.Balance != 1000-20 {
+		t.Errorf("expected only the handed over order to be paid, got balance %d", user.Balance)
+	}
+}
+
+func TestShopPriceSnapshot(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	newUser(t, store, "alice", service.WelcomCoins)
+
+	shop := service.NewShop(store, service.ShopConfig{CancelWindow: time.Hour})
+	catalog := service.NewCatalog(store)
+	account := service.NewAccount(store)
+
+	order, err := shop.PlaceOrder(ctx, "alice", []db.OrderLine{{Item: "cup", Quantity: 2}})
+	if err != nil {
+		t.Fatalf("failed to place order: %v", err)
+	}
+	price := int64(35)
+	if _, err := catalog.Update(ctx, "admin", "cup", service.ItemPatch{Price: &price}); err != nil {
+		t.Fatalf("failed to change the price: %v", err)
+	}
+	if err := shop.Buy(ctx, "alice", "cup"); err != nil {
+		t.Fatalf("failed to buy: %v", err)
+	}
+
+	info, err := account.Info(ctx, "alice")
+	if err != nil {
+		t.Fatalf("failed to get info: %v", err)
+	}
+	if len(info.Inventory) != 1 || info.Inventory[0].Quantity != 3 || len(info.Inventory[0].Details) != 2 {
+		t.Fatalf("unexpected inventory: %+v", info.Inventory)
+	}
+	details := info.Inventory[0].Details
+	if details[0].Price != 20 || details[0].Quantity != 2 || details[0].OrderID != order.ID || details[1].Price != 35 {
+		t.Errorf("expected the paid prices to be kept, got %+v", details)
+	}
+
+	refunded, err := shop.CancelOrder(ctx, "alice", order.ID)
+	if err != nil {
+		t.Fatalf("failed to cancel order: %v", err)
+	}
+	if refunded.Lines[0].Price != 20 {
+		t.Errorf("expected the order to keep the paid price, got %+v", refunded.Lines)
+	}
+	if info, _ := account.Info(ctx, "alice"); info.Balance != service.WelcomCoins-35 || info.Refunds[0].Amount != 40 {
+		t.Errorf("expected a refund of the paid 40 coins, got balance %d and %+v", info.Balance, info.Refunds)
+	}
+
+	report, err := service.NewLedger(store).Reconcile(ctx, false)
+	if err != nil {
+		t.Fatalf("failed to reconcile: %v", err)
+	}
+	if len(report.Mismatches) != 0 {
+		t.Errorf("expected no mismatches after a price change, got %+v", report.Mismatches)
+	}
+}
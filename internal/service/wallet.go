@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/titoffon/merch-store/internal/db"
+)
+
+// MaxTransferMessageLen - предельная длина сообщения к переводу в символах.
+const MaxTransferMessageLen = 200
+
+// TransferCategories - категории, которыми можно подписать перевод.
+var TransferCategories = []string{"help", "teamwork", "birthday", "thanks", "other"}
+
+// TransferReactions - реакции, которые получатель может поставить на перевод.
+var TransferReactions = []string{"thanks", "heart", "clap", "party"}
+
+// TransferNote - необязательная подпись отправителя к переводу.
+type TransferNote struct {
+	Message  string
+	Category string
+}
+
+// normalize обрезает пробелы вокруг сообщения и проверяет подпись:
+// сообщение - не длиннее MaxTransferMessageLen символов без управляющих,
+// категория - пустая или из TransferCategories.
+func (n TransferNote) normalize() (TransferNote, error) {
+	n.Message = strings.TrimSpace(n.Message)
+	if !utf8.ValidString(n.Message) || utf8.RuneCountInString(n.Message) > MaxTransferMessageLen {
+		return n, ErrInvalidTransferNote
+	}
+	if strings.ContainsFunc(n.Message, unicode.IsControl) {
+		return n, ErrInvalidTransferNote
+	}
+	if n.Category != "" && !slices.Contains(TransferCategories, n.Category) {
+		return n, ErrInvalidTransferNote
+	}
+	return n, nil
+}
+
+// Wallet переводит монеты между пользователями.
+type Wallet struct {
+	store db.Storage
+}
+
+func NewWallet(store db.Storage) *Wallet {
+	return &Wallet{store: store}
+}
+
+// Transfer проводит amount со счёта from на счёт to и пишет перевод
+// в историю одной транзакцией. Встречные переводы блокируют счета в одном
+// порядке, а откатившаяся из-за конфликта транзакция повторяется.
+func (w *Wallet) Transfer(ctx context.Context, from, to string, amount int64, note TransferNote) error {
+	if to == "" || amount <= 0 {
+		return ErrInvalidTransfer
+	}
+	note, err := note.normalize()
+	if err != nil {
+		return err
+	}
+
+	receiver, err := w.store.GetUserByName(ctx, to)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve receiver: %w", err)
+	}
+	if receiver == nil {
+		return ErrReceiverNotFound
+	}
+
+	return w.store.InTx(ctx, func(tx db.Tx) error {
+		err := moveCoins(ctx, tx, db.EntryTransfer, "", db.UserAccount(from), db.UserAccount(receiver.Username), amount)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.InsertTransaction_log(ctx, db.TransactionLog{
+			Sender:    from,
+			Recipient: receiver.Username,
+			Amount:    amount,
+			Message:   note.Message,
+			Category:  note.Category,
+		})
+		return err
+	})
+}
+
+// React ставит реакцию получателя username на перевод id. Пустая реакция
+// снимает прежнюю. Чужой перевод для получателя не существует.
+func (w *Wallet) React(ctx context.Context, username string, id int64, reaction string) error {
+	if reaction != "" && !slices.Contains(TransferReactions, reaction) {
+		return ErrInvalidReaction
+	}
+	if id <= 0 {
+		return ErrTransferNotFound
+	}
+
+	err := w.store.SetTransferReaction(ctx, id, username, reaction)
+	if err != nil {
+		if errors.Is(err, db.ErrTransferNotFound) {
+			return ErrTransferNotFound
+		}
+		return fmt.Errorf("failed to set transfer reaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/titoffon/merch-store/internal/db/memory"
+	"github.com/titoffon/merch-store/internal/service"
+)
+
+func TestWalletTransfer(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	newUser(t, store, "alice", 100)
+	newUser(t, store, "bob", 0)
+
+	wallet := service.NewWallet(store)
+	account := service.NewAccount(store)
+
+	tests := []struct {
+		name    string
+		to      string
+		amount  int64
+		wantErr error
+	}{
+		{name: "empty receiver", to: "", amount: 10, wantErr: service.ErrInvalidTransfer},
+		{name: "non-positive amount", to: "bob", amount: 0, wantErr: service.ErrInvalidTransfer},
+		{name: "unknown receiver", to: "ghost", amount: 10, wantErr: service.ErrReceiverNotFound},
+		{name: "not enough coins", to: "bob", amount: 101, wantErr: service.ErrInsufficientFunds},
+		{name: "green", to: "bob", amount: 60},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := wallet.Transfer(ctx, "alice", tc.to, tc.amount, service.TransferNote{})
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("expected %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+
+	alice, err := account.Info(ctx, "alice")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if alice.Balance != 40 || len(alice.Sent) != 1 || alice.Sent[0].ToUser != "bob" {
+		t.Errorf("unexpected sender info: %+v", alice)
+	}
+
+	bob, err := account.Info(ctx, "bob")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if bob.Balance != 60 || len(bob.Received) != 1 || bob.Received[0].FromUser != "alice" {
+		t.Errorf("unexpected receiver info: %+v", bob)
+	}
+
+	if _, err := account.Info(ctx, "ghost"); !errors.Is(err, service.ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestWalletConcurrentCrossTransfers(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	newUser(t, store, "alice", service.WelcomCoins)
+	newUser(t, store, "bob", service.WelcomCoins)
+
+	wallet := service.NewWallet(store)
+	const transfers = 50
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*transfers)
+	for range transfers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- wallet.Transfer(ctx, "alice", "bob", 7, service.TransferNote{})
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- wallet.Transfer(ctx, "bob", "alice", 7, service.TransferNote{})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("transfer failed: %v", err)
+		}
+	}
+
+	ledger := service.NewLedger(store)
+	for _, name := range []string{"alice", "bob"} {
+		user, _ := store.GetUserByName(ctx, name)
+		if user.Balance != service.WelcomCoins {
+			t.Errorf("expected %s to end with %d coins, got %d", name, service.WelcomCoins, user.Balance)
+		}
+		if err := ledger.Verify(ctx, name); err != nil {
+			t.Error(err)
+		}
+	}
+	if report, _ := ledger.Reconcile(ctx, false); len(report.Mismatches) != 0 {
+		t.Errorf("unexpected mismatches: %+v", report.Mismatches)
+	}
+}
+
+func TestWalletTransferNote(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	newUser(t, store, "alice", 100)
+	newUser(t, store, "bob", 0)
+
+	wallet := service.NewWallet(store)
+
+	tests := []struct {
+		name    string
+		note    service.TransferNote
+		wantErr error
+	}{
+		{name: "too long", note: service.TransferNote{Message: strings.Repeat("я", service.MaxTransferMessageLen+1)}, wantErr: service.ErrInvalidTransferNote},
+		{name: "control characters", note: service.TransferNote{Message: "hi\x00there"}, wantErr: service.ErrInvalidTransferNote},
+		{name: "invalid utf-8", note: service.TransferNote{Message: "\xff"}, wantErr: service.ErrInvalidTransferNote},
+		{name: "unknown category", note: service.TransferNote{Category: "bribe"}, wantErr: service.ErrInvalidTransferNote},
+		{name: "no note", note: service.TransferNote{}},
+		{name: "green", note: service.TransferNote{Message: strings.Repeat("я", service.MaxTransferMessageLen) + "  ", Category: "birthday"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := wallet.Transfer(ctx, "alice", "bob", 1, tc.note)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("expected %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+
+	received, _ := store.GetTransactionsReceived(ctx, "bob")
+	if len(received) != 2 {
+		t.Fatalf("expected 2 transfers, got %+v", received)
+	}
+	last := received[0]
+	if last.Category != "birthday" || last.Message != strings.Repeat("я", service.MaxTransferMessageLen) {
+		t.Errorf("unexpected stored note: %+v", last)
+	}
+
+	if err := wallet.React(ctx, "bob", last.ID, "wow"); !errors.Is(err, service.ErrInvalidReaction) {
+		t.Errorf("expected ErrInvalidReaction, got %v", err)
+	}
+	if err := wallet.React(ctx, "alice", last.ID, "clap"); !errors.Is(err, service.ErrTransferNotFound) {
+		t.Errorf("expected ErrTransferNotFound for the sender, got %v", err)
+	}
+	if err := wallet.React(ctx, "bob", last.ID, "clap"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	sent, _ := store.GetTransactionsSent(ctx, "alice")
+	if sent[0].Reaction != "clap" || sent[1].Reaction != "" {
+		t.Errorf("unexpected reactions: %+v", sent)
+	}
+	if err := wallet.React(ctx, "bob", last.ID, ""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if sent, _ := store.GetTransactionsSent(ctx, "alice"); sent[0].Reaction != "" {
+		t.Errorf("expected reaction to be cleared, got %q", sent[0].Reaction)
+	}
+}
@@ -0,0 +1,289 @@
+// Package token выпускает и проверяет access-токены (JWT). Manager
+// настраивается один раз из конфига: алгоритм подписи фиксирован, а ключи
+// различаются по заголовку kid, что позволяет менять ключ без простоя -
+// новым подписываются токены, старые ещё принимаются при проверке.
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/titoffon/merch-store/internal/config"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// leeway - допустимое расхождение часов при проверке exp, nbf и iat.
+const leeway = 30 * time.Second
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims - содержимое access-токена.
+type Claims struct {
+	Username string   `json:"sub"`
+	Roles    []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Config описывает ключи и параметры токенов.
+type Config struct {
+	// Algorithm - единственный допустимый алгоритм: HS256, RS256 или EdDSA.
+	Algorithm string
+	// KeyID - kid текущего ключа, которым подписываются новые токены.
+	KeyID string
+	// Secret - текущий секрет для HS256.
+	Secret []byte
+	// PreviousSecrets - предыдущие секреты HS256 по kid, только для проверки.
+	PreviousSecrets map[string][]byte
+	// PrivateKeyFile - PEM с текущим закрытым ключом для RS256/EdDSA.
+	PrivateKeyFile string
+	// PreviousPublicKeyFiles - PEM с предыдущими открытыми ключами по kid.
+	PreviousPublicKeyFiles map[string]string
+
+	Issuer    string
+	Audience  string
+	AccessTTL time.Duration
+}
+
+type key struct {
+	id     string
+	sign   any
+	verify any
+}
+
+type Manager struct {
+	method   jwt.SigningMethod
+	current  key
+	keys     map[string]key
+	issuer   string
+	audience string
+	ttl      time.Duration
+	parser   *jwt.Parser
+}
+
+// NewFromConfig собирает Manager из настроек приложения.
+func NewFromConfig(cfg *config.Config) (*Manager, error) {
+	previous := make(map[string][]byte, len(cfg.JWTPreviousSecrets))
+	for kid, secret := range cfg.JWTPreviousSecrets {
+		previous[kid] = []byte(secret)
+	}
+
+	return New(Config{
+		Algorithm:              cfg.JWTAlgorithm,
+		KeyID:                  cfg.JWTKeyID,
+		Secret:                 []byte(cfg.JWTSecret),
+		PreviousSecrets:        previous,
+		PrivateKeyFile:         cfg.JWTPrivateKeyFile,
+		PreviousPublicKeyFiles: cfg.JWTPreviousPublicKeyFiles,
+		Issuer:                 cfg.JWTIssuer,
+		Audience:               cfg.JWTAudience,
+		AccessTTL:              cfg.JWTAccessTTL,
+	})
+}
+
+func New(cfg Config) (*Manager, error) {
+	if cfg.KeyID == "" {
+		return nil, errors.New("token: key id must not be empty")
+	}
+	if cfg.AccessTTL <= 0 {
+		return nil, errors.New("token: access token TTL must be positive")
+	}
+
+	m := &Manager{
+		keys:     make(map[string]key),
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		ttl:      cfg.AccessTTL,
+	}
+
+	var err error
+	switch cfg.Algorithm {
+	case AlgHS256:
+		m.method = jwt.SigningMethodHS256
+		err = m.loadHMACKeys(cfg)
+	case AlgRS256:
+		m.method = jwt.SigningMethodRS256
+		err = m.loadKeyFiles(cfg, loadRSAPrivateKey, loadRSAPublicKey)
+	case AlgEdDSA:
+		m.method = jwt.SigningMethodEdDSA
+		err = m.loadKeyFiles(cfg, loadEdPrivateKey, loadEdPublicKey)
+	default:
+		return nil, fmt.Errorf("token: unsupported algorithm %q", cfg.Algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m.parser = jwt.NewParser(
+		jwt.WithValidMethods([]string{m.method.Alg()}),
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithAudience(cfg.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(leeway),
+	)
+	return m, nil
+}
+
+func (m *Manager) loadHMACKeys(cfg Config) error {
+	if len(cfg.Secret) == 0 {
+		return errors.New("token: HS256 requires a secret")
+	}
+	m.current = key{id: cfg.KeyID, sign: cfg.Secret, verify: cfg.Secret}
+	m.keys[cfg.KeyID] = m.current
+
+	for kid, secret := range cfg.PreviousSecrets {
+		if err := m.addVerifyKey(kid, secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manager) loadKeyFiles(cfg Config, loadPrivate func([]byte) (crypto.Signer, error), loadPublic func([]byte) (crypto.PublicKey, error)) error {
+	if cfg.PrivateKeyFile == "" {
+		return fmt.Errorf("token: %s requires a private key file", cfg.Algorithm)
+	}
+	pem, err := os.ReadFile(cfg.PrivateKeyFile)
+	if err != nil {
+		return fmt.Errorf("token: failed to read private key: %w", err)
+	}
+	private, err := loadPrivate(pem)
+	if err != nil {
+		return fmt.Errorf("token: failed to parse private key: %w", err)
+	}
+	m.current = key{id: cfg.KeyID, sign: private, verify: private.Public()}
+	m.keys[cfg.KeyID] = m.current
+
+	for kid, file := range cfg.PreviousPublicKeyFiles {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("token: failed to read public key %q: %w", kid, err)
+		}
+		public, err := loadPublic(pem)
+		if err != nil {
+			return fmt.Errorf("token: failed to parse public key %q: %w", kid, err)
+		}
+		if err := m.addVerifyKey(kid, public); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manager) addVerifyKey(kid string, verify any) error {
+	if kid == "" {
+		return errors.New("token: previous key id must not be empty")
+	}
+	if _, ok := m.keys[kid]; ok {
+		return fmt.Errorf("token: duplicate key id %q", kid)
+	}
+	m.keys[kid] = key{id: kid, verify: verify}
+	return nil
+}
+
+// Issue подписывает текущим ключом токен для username с его ролями.
+func (m *Manager) Issue(username string, roles ...string) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
+	}
+
+	now := time.Now()
+	claims := Claims{
+		Username: username,
+		Roles:    roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(id),
+			Issuer:    m.issuer,
+			Audience:  jwt.ClaimStrings{m.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.ttl)),
+		},
+	}
+
+	t := jwt.NewWithClaims(m.method, claims)
+	t.Header["kid"] = m.current.id
+	return t.SignedString(m.current.sign)
+}
+
+// Verify проверяет подпись, алгоритм и обязательные claims токена.
+// Токены без kid проверяются текущим ключом.
+func (m *Manager) Verify(tokenStr string) (*Claims, error) {
+	t, err := m.parser.ParseWithClaims(tokenStr, &Claims{}, m.keyFunc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	claims, ok := t.Claims.(*Claims)
+	if !ok || !t.Valid {
+		return nil, ErrInvalidToken
+	}
+	if claims.IssuedAt == nil || claims.NotBefore == nil {
+		return nil, fmt.Errorf("%w: token has no iat or nbf claim", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+func (m *Manager) keyFunc(t *jwt.Token) (any, error) {
+	if t.Method.Alg() != m.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q", t.Method.Alg())
+	}
+
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		return m.current.verify, nil
+	}
+	k, ok := m.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return k.verify, nil
+}
+
+func loadRSAPrivateKey(pem []byte) (crypto.Signer, error) {
+	return jwt.ParseRSAPrivateKeyFromPEM(pem)
+}
+
+func loadRSAPublicKey(pem []byte) (crypto.PublicKey, error) {
+	public, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+	if err != nil {
+		return nil, err
+	}
+	return public, nil
+}
+
+func loadEdPrivateKey(pem []byte) (crypto.Signer, error) {
+	private, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := private.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 private key")
+	}
+	return signer, nil
+}
+
+func loadEdPublicKey(pem []byte) (crypto.PublicKey, error) {
+	public, err := jwt.ParseEdPublicKeyFromPEM(pem)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := public.(ed25519.PublicKey); !ok {
+		return nil, errors.New("not an Ed25519 public key")
+	}
+	return public, nil
+}
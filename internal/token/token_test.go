@@ -0,0 +1,310 @@
+package token_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/titoffon/merch-store/internal/token"
+)
+
+func hmacConfig(kid, secret string) token.Config {
+	return token.Config{
+		Algorithm: token.AlgHS256,
+		KeyID:     kid,
+		Secret:    []byte(secret),
+		Issuer:    "merch-store",
+		Audience:  "merch-store",
+		AccessTTL: time.Minute,
+	}
+}
+
+func newManager(t *testing.T, cfg token.Config) *token.Manager {
+	t.Helper()
+	m, err := token.New(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	return m
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	m := newManager(t, hmacConfig("2025", "testSecretKey"))
+
+	tokenStr, err := m.Issue("testUser")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(tokenStr, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("failed to parse token: %v", err)
+	}
+	if parsed.Header["kid"] != "2025" {
+		t.Errorf("expected kid=2025, got %v", parsed.Header["kid"])
+	}
+	claims := parsed.Claims.(jwt.MapClaims)
+	for _, claim := range []string{"sub", "iss", "aud", "exp", "iat", "nbf", "jti"} {
+		if _, ok := claims[claim]; !ok {
+			t.Errorf("expected %s claim to be set", claim)
+		}
+	}
+
+	verified, err := m.Verify(tokenStr)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if verified.Username != "testUser" {
+		t.Errorf("expected sub=testUser, got %q", verified.Username)
+	}
+	if len(verified.Roles) != 0 {
+		t.Errorf("expected no roles, got %v", verified.Roles)
+	}
+	if verified.ID == "" {
+		t.Error("expected non-empty token id")
+	}
+	if lifetime := time.Until(verified.ExpiresAt.Time); lifetime <= 0 || lifetime > time.Minute {
+		t.Errorf("expected token to expire within a minute, expires in %s", lifetime)
+	}
+}
+
+func TestIssueWithRoles(t *testing.T) {
+	m := newManager(t, hmacConfig("2025", "testSecretKey"))
+
+	tokenStr, err := m.Issue("admin", "admin")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	claims, err := m.Verify(tokenStr)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(claims.Roles) != 1 || claims.Roles[0] != "admin" {
+		t.Errorf("expected roles [admin], got %v", claims.Roles)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := newManager(t, hmacConfig("2024", "oldSecret"))
+	oldToken, err := old.Issue("alice")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	cfg := hmacConfig("2025", "newSecret")
+	cfg.PreviousSecrets = map[string][]byte{"2024": []byte("oldSecret")}
+	rotated := newManager(t, cfg)
+
+	if _, err := rotated.Verify(oldToken); err != nil {
+		t.Errorf("expected token signed with previous key to be accepted, got %v", err)
+	}
+
+	newToken, err := rotated.Issue("alice")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := old.Verify(newToken); !errors.Is(err, token.ErrInvalidToken) {
+		t.Errorf("expected old manager to reject unknown kid, got %v", err)
+	}
+
+	retired := newManager(t, hmacConfig("2025", "newSecret"))
+	if _, err := retired.Verify(oldToken); !errors.Is(err, token.ErrInvalidToken) {
+		t.Errorf("expected retired key to be rejected, got %v", err)
+	}
+}
+
+func TestAlgorithmPinning(t *testing.T) {
+	dir := t.TempDir()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	privateFile := writePEM(t, dir, "private.pem", "PRIVATE KEY", mustMarshalPKCS8(t, private))
+	publicDER, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	m := newManager(t, token.Config{
+		Algorithm:      token.AlgRS256,
+		KeyID:          "rsa",
+		PrivateKeyFile: privateFile,
+		Issuer:         "merch-store",
+		Audience:       "merch-store",
+		AccessTTL:      time.Minute,
+	})
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub": "mallory",
+		"iss": "merch-store",
+		"aud": "merch-store",
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(time.Minute).Unix(),
+	}
+
+	// HS256, подписанный открытым ключом, - классическая подмена алгоритма.
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(publicPEM)
+	if err != nil {
+		t.Fatalf("failed to sign forged token: %v", err)
+	}
+	if _, err := m.Verify(forged); !errors.Is(err, token.ErrInvalidToken) {
+		t.Errorf("expected HS256 token to be rejected by RS256 manager, got %v", err)
+	}
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("failed to build unsigned token: %v", err)
+	}
+	if _, err := m.Verify(unsigned); !errors.Is(err, token.ErrInvalidToken) {
+		t.Errorf("expected alg=none token to be rejected, got %v", err)
+	}
+}
+
+func TestKeyPairs(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	oldRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	oldRSAFile := writePEM(t, dir, "old-rsa.pem", "PRIVATE KEY", mustMarshalPKCS8(t, oldRSAKey))
+	oldPublicDER, err := x509.MarshalPKIXPublicKey(&oldRSAKey.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		alg      string
+		key      any
+		previous map[string]string
+	}{
+		{
+			name: "RS256",
+			alg:  token.AlgRS256,
+			key:  rsaKey,
+			previous: map[string]string{
+				"old": writePEM(t, dir, "old-rsa.pub.pem", "PUBLIC KEY", oldPublicDER),
+			},
+		},
+		{name: "EdDSA", alg: token.AlgEdDSA, key: edKey},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newManager(t, token.Config{
+				Algorithm:              tc.alg,
+				KeyID:                  "current",
+				PrivateKeyFile:         writePEM(t, dir, tc.name+".pem", "PRIVATE KEY", mustMarshalPKCS8(t, tc.key)),
+				PreviousPublicKeyFiles: tc.previous,
+				Issuer:                 "merch-store",
+				Audience:               "merch-store",
+				AccessTTL:              time.Minute,
+			})
+
+			tokenStr, err := m.Issue("bob")
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			claims, err := m.Verify(tokenStr)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if claims.Username != "bob" {
+				t.Errorf("expected sub=bob, got %q", claims.Username)
+			}
+		})
+	}
+
+	t.Run("RS256 previous key", func(t *testing.T) {
+		old := newManager(t, token.Config{
+			Algorithm:      token.AlgRS256,
+			KeyID:          "old",
+			PrivateKeyFile: oldRSAFile,
+			Issuer:         "merch-store",
+			Audience:       "merch-store",
+			AccessTTL:      time.Minute,
+		})
+		oldToken, err := old.Issue("bob")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		current := newManager(t, token.Config{
+			Algorithm:              token.AlgRS256,
+			KeyID:                  "current",
+			PrivateKeyFile:         filepath.Join(dir, "RS256.pem"),
+			PreviousPublicKeyFiles: tests[0].previous,
+			Issuer:                 "merch-store",
+			Audience:               "merch-store",
+			AccessTTL:              time.Minute,
+		})
+		if _, err := current.Verify(oldToken); err != nil {
+			t.Errorf("expected token signed with previous key pair to be accepted, got %v", err)
+		}
+	})
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  token.Config
+	}{
+		{name: "unknown algorithm", cfg: func() token.Config { c := hmacConfig("k", "s"); c.Algorithm = "none"; return c }()},
+		{name: "empty secret", cfg: hmacConfig("k", "")},
+		{name: "empty key id", cfg: hmacConfig("", "s")},
+		{name: "duplicate key id", cfg: func() token.Config {
+			c := hmacConfig("k", "s")
+			c.PreviousSecrets = map[string][]byte{"k": []byte("old")}
+			return c
+		}()},
+		{name: "RS256 without key file", cfg: token.Config{Algorithm: token.AlgRS256, KeyID: "k", AccessTTL: time.Minute}},
+		{name: "non-positive TTL", cfg: func() token.Config { c := hmacConfig("k", "s"); c.AccessTTL = 0; return c }()},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := token.New(tc.cfg); err == nil {
+				t.Error("expected an error, got nil")
+			}
+		})
+	}
+}
+
+func mustMarshalPKCS8(t *testing.T, key any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal private key: %v", err)
+	}
+	return der
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return file
+}
@@ -24,7 +24,8 @@ INSERT INTO merch (name, price) VALUES
 ('umbrella', 200),
 ('socks', 10),
 ('wallet', 50),
-('pink-hoody', 500);
+('pink-hoody', 500)
+ON CONFLICT (name) DO NOTHING;
 
 -- Создание таблицы покупок (purchases) для хранения покупок пользователей
 CREATE TABLE IF NOT EXISTS purchases (
@@ -0,0 +1,15 @@
+-- Refresh-токены хранятся только в виде SHA-256 хеша. Токены одной цепочки
+-- ротаций объединены family_id: повторное использование уже заменённого
+-- токена отзывает всю цепочку.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    family_id VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMPTZ,
+    replaced_by VARCHAR(64),
+    FOREIGN KEY (username) REFERENCES users (username)
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
@@ -0,0 +1,8 @@
+-- Счётчики неудачных входов. key - "user:<имя>" или "ip:<адрес>";
+-- locked_until задаёт временную блокировку входа по этому ключу.
+CREATE TABLE IF NOT EXISTS login_failures (
+    key VARCHAR(300) PRIMARY KEY,
+    failures INT NOT NULL,
+    locked_until TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL
+);
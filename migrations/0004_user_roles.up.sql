@@ -0,0 +1,3 @@
+-- Роли пользователя. Обычный сотрудник ролей не имеет, права администратора
+-- даёт роль admin.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS roles TEXT[] NOT NULL DEFAULT '{}';
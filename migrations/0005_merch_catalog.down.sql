@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS audit_log;
+
+ALTER TABLE merch
+    DROP CONSTRAINT IF EXISTS merch_price_positive,
+    DROP COLUMN IF EXISTS active,
+    DROP COLUMN IF EXISTS image_url,
+    DROP COLUMN IF EXISTS category,
+    DROP COLUMN IF EXISTS description;
@@ -0,0 +1,3 @@
+ALTER TABLE merch
+    DROP CONSTRAINT IF EXISTS merch_stock_non_negative,
+    DROP COLUMN IF EXISTS stock;
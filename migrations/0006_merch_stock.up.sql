@@ -0,0 +1,3 @@
+-- Остаток товара на складе. NULL - товар не ограничен.
+ALTER TABLE merch ADD COLUMN IF NOT EXISTS stock BIGINT;
+ALTER TABLE merch ADD CONSTRAINT merch_stock_non_negative CHECK (stock >= 0);
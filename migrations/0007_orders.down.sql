@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS purchases_order_id_idx;
+ALTER TABLE purchases
+    DROP CONSTRAINT IF EXISTS purchases_quantity_positive,
+    DROP COLUMN IF EXISTS quantity,
+    DROP COLUMN IF EXISTS order_id;
+DROP TABLE IF EXISTS orders;
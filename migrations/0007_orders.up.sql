@@ -0,0 +1,18 @@
+-- Заказ объединяет несколько строк покупок, оплаченных одной транзакцией.
+CREATE TABLE IF NOT EXISTS orders (
+    id BIGSERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL REFERENCES users (username),
+    total BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT orders_total_positive CHECK (total > 0)
+);
+
+CREATE INDEX IF NOT EXISTS orders_username_idx ON orders (username, created_at);
+
+-- Старые покупки остаются без заказа и считаются одной штукой.
+ALTER TABLE purchases
+    ADD COLUMN IF NOT EXISTS order_id BIGINT REFERENCES orders (id),
+    ADD COLUMN IF NOT EXISTS quantity BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE purchases ADD CONSTRAINT purchases_quantity_positive CHECK (quantity > 0);
+
+CREATE INDEX IF NOT EXISTS purchases_order_id_idx ON purchases (order_id);
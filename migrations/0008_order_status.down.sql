@@ -0,0 +1,6 @@
+ALTER TABLE purchases DROP COLUMN IF EXISTS id;
+DROP INDEX IF EXISTS orders_status_idx;
+ALTER TABLE orders
+    DROP CONSTRAINT IF EXISTS orders_status_known,
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS status;
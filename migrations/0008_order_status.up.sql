@@ -0,0 +1,11 @@
+-- Статус заказа: placed -> ready -> handed_over, либо cancelled.
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'placed',
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE orders ADD CONSTRAINT orders_status_known
+    CHECK (status IN ('placed', 'ready', 'handed_over', 'cancelled'));
+
+CREATE INDEX IF NOT EXISTS orders_status_idx ON orders (status, created_at);
+
+-- У строк покупок появляется собственный идентификатор.
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS id BIGSERIAL PRIMARY KEY;
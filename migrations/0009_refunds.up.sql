@@ -0,0 +1,11 @@
+-- Возврат монет за отменённый заказ. Один заказ возвращается не больше одного раза.
+CREATE TABLE IF NOT EXISTS refunds (
+    id BIGSERIAL PRIMARY KEY,
+    order_id BIGINT NOT NULL UNIQUE REFERENCES orders (id),
+    username VARCHAR(255) NOT NULL REFERENCES users (username),
+    amount BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT refunds_amount_positive CHECK (amount > 0)
+);
+
+CREATE INDEX IF NOT EXISTS refunds_username_idx ON refunds (username, created_at);
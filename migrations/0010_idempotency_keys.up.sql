@@ -0,0 +1,15 @@
+-- Ключи идемпотентности: повтор запроса с тем же ключом получает сохранённый
+-- ответ вместо повторного списания. status_code NULL - запрос ещё выполняется.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    username VARCHAR(255) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    fingerprint TEXT NOT NULL,
+    status_code INT,
+    content_type TEXT NOT NULL DEFAULT '',
+    response BYTEA,
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (username, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
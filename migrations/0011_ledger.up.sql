@@ -0,0 +1,66 @@
+-- Двойная запись: каждое движение монет - проводка (journal_entries) из
+-- нескольких строк (postings), сумма которых равна нулю. users.balance
+-- остаётся кешем суммы строк по счёту пользователя.
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    id VARCHAR(300) PRIMARY KEY,
+    kind VARCHAR(20) NOT NULL,
+    username VARCHAR(255) UNIQUE REFERENCES users (username),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT ledger_accounts_kind_known CHECK (kind IN ('user', 'system')),
+    CONSTRAINT ledger_accounts_user_has_username CHECK ((kind = 'user') = (username IS NOT NULL))
+);
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(30) NOT NULL,
+    reference TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS postings (
+    id BIGSERIAL PRIMARY KEY,
+    entry_id BIGINT NOT NULL REFERENCES journal_entries (id),
+    account_id VARCHAR(300) NOT NULL REFERENCES ledger_accounts (id),
+    amount BIGINT NOT NULL,
+    CONSTRAINT postings_amount_non_zero CHECK (amount <> 0)
+);
+
+CREATE INDEX IF NOT EXISTS postings_entry_id_idx ON postings (entry_id);
+CREATE INDEX IF NOT EXISTS postings_account_id_idx ON postings (account_id);
+
+-- Сумма строк проводки проверяется при COMMIT, когда записаны все строки.
+CREATE OR REPLACE FUNCTION check_journal_entry_balanced() RETURNS trigger AS $$
+BEGIN
+    IF (SELECT COALESCE(SUM(amount), 0) FROM postings WHERE entry_id = NEW.entry_id) <> 0 THEN
+        RAISE EXCEPTION 'journal entry % is not balanced', NEW.entry_id
+            USING ERRCODE = 'check_violation';
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER postings_balanced
+    AFTER INSERT OR UPDATE ON postings
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION check_journal_entry_balanced();
+
+INSERT INTO ledger_accounts (id, kind) VALUES
+('system:issuance', 'system'),
+('system:shop', 'system')
+ON CONFLICT (id) DO NOTHING;
+
+INSERT INTO ledger_accounts (id, kind, username)
+SELECT 'user:' || username, 'user', username FROM users
+ON CONFLICT (id) DO NOTHING;
+
+-- Текущие балансы переносятся в книгу одной вводной проводкой на пользователя.
+-- Ссылка та же, что у приветственной проводки нового пользователя: счёт 'user:<имя>'.
+WITH opening AS (
+    INSERT INTO journal_entries (kind, reference)
+    SELECT 'opening', 'user:' || username FROM users WHERE balance > 0
+    RETURNING id, reference
+)
+INSERT INTO postings (entry_id, account_id, amount)
+SELECT o.id, o.reference, u.balance FROM opening o JOIN users u ON 'user:' || u.username = o.reference
+UNION ALL
+SELECT o.id, 'system:issuance', -u.balance FROM opening o JOIN users u ON 'user:' || u.username = o.reference;
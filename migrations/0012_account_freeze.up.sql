@@ -0,0 +1,3 @@
+-- Замороженный пользователь не может тратить и переводить монеты, пока его
+-- баланс не сверят вручную. Зачисления на его счёт проходят.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS frozen BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+ALTER TABLE purchases
+    DROP COLUMN IF EXISTS currency,
+    DROP COLUMN IF EXISTS price;
@@ -0,0 +1,11 @@
+-- Цена и валюта фиксируются в строке покупки в момент оплаты, чтобы смена
+-- merch.price не переписывала историю. Для старых строк другой информации
+-- нет, поэтому они получают текущую цену товара.
+ALTER TABLE purchases
+    ADD COLUMN IF NOT EXISTS price BIGINT,
+    ADD COLUMN IF NOT EXISTS currency VARCHAR(16) NOT NULL DEFAULT 'coin';
+
+UPDATE purchases p SET price = m.price FROM merch m WHERE m.name = p.merch_item AND p.price IS NULL;
+
+ALTER TABLE purchases ALTER COLUMN price SET NOT NULL;
+ALTER TABLE purchases ADD CONSTRAINT purchases_price_positive CHECK (price > 0);
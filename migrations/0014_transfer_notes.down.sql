@@ -0,0 +1,5 @@
+ALTER TABLE transaction_log
+    DROP COLUMN IF EXISTS reacted_at,
+    DROP COLUMN IF EXISTS reaction,
+    DROP COLUMN IF EXISTS category,
+    DROP COLUMN IF EXISTS message;
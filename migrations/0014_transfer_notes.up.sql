@@ -0,0 +1,7 @@
+-- Перевод может нести сообщение и категорию от отправителя и реакцию
+-- получателя. Старые переводы остаются без них.
+ALTER TABLE transaction_log
+    ADD COLUMN IF NOT EXISTS message VARCHAR(200) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS category VARCHAR(32) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS reaction VARCHAR(32) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS reacted_at TIMESTAMPTZ;
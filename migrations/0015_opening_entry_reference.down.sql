@@ -0,0 +1,3 @@
+-- Ссылки 'user:<имя>' у вводных проводок корректны и для схемы 0014,
+-- откатывать нечего.
+SELECT 1;
@@ -0,0 +1,6 @@
+-- Базы, где 0011 уже применена, получили вводные проводки со ссылкой на
+-- голое имя пользователя. Приводим их к формату 'user:<имя>', как у
+-- приветственных проводок.
+UPDATE journal_entries
+SET reference = 'user:' || reference
+WHERE kind = 'opening' AND reference NOT LIKE 'user:%';
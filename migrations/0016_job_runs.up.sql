@@ -0,0 +1,8 @@
+-- Запуски фоновых задач по расписанию: слот занимает первый экземпляр
+-- сервиса, остальные его пропускают.
+CREATE TABLE IF NOT EXISTS job_runs (
+    job VARCHAR(100) NOT NULL,
+    slot TIMESTAMPTZ NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (job, slot)
+);
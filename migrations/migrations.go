@@ -0,0 +1,8 @@
+// Package migrations встраивает SQL-миграции схемы в бинарник.
+// Файлы называются <версия>_<имя>.up.sql и <версия>_<имя>.down.sql.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS